@@ -0,0 +1,266 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        (unknown)
+// source: goapi/annotations.proto
+
+package goapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Envelope 描述接口返回的业务外层结构，如 {"errcode":40001,"errmsg":"...","data":{...}}，
+// 业务码不是成功值时生成的代码返回 BusinessError
+type Envelope struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// code_field 业务码字段名，如 errcode
+	CodeField string `protobuf:"bytes,1,opt,name=code_field,json=codeField,proto3" json:"code_field,omitempty"`
+	// message_field 错误信息字段名，如 errmsg
+	MessageField string `protobuf:"bytes,2,opt,name=message_field,json=messageField,proto3" json:"message_field,omitempty"`
+	// success_value 表示成功的业务码，默认 0，返回里没有业务码字段时也是成功
+	SuccessValue string `protobuf:"bytes,3,opt,name=success_value,json=successValue,proto3" json:"success_value,omitempty"`
+	// data_field 数据字段名，如 data，为空时整个返回解析到返回类型
+	DataField string `protobuf:"bytes,4,opt,name=data_field,json=dataField,proto3" json:"data_field,omitempty"`
+}
+
+func (x *Envelope) Reset() {
+	*x = Envelope{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_goapi_annotations_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Envelope) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Envelope) ProtoMessage() {}
+
+func (x *Envelope) ProtoReflect() protoreflect.Message {
+	mi := &file_goapi_annotations_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Envelope.ProtoReflect.Descriptor instead.
+func (*Envelope) Descriptor() ([]byte, []int) {
+	return file_goapi_annotations_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Envelope) GetCodeField() string {
+	if x != nil {
+		return x.CodeField
+	}
+	return ""
+}
+
+func (x *Envelope) GetMessageField() string {
+	if x != nil {
+		return x.MessageField
+	}
+	return ""
+}
+
+func (x *Envelope) GetSuccessValue() string {
+	if x != nil {
+		return x.SuccessValue
+	}
+	return ""
+}
+
+func (x *Envelope) GetDataField() string {
+	if x != nil {
+		return x.DataField
+	}
+	return ""
+}
+
+var file_goapi_annotations_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         51201,
+		Name:          "goapi.unauthenticated",
+		Tag:           "varint,51201,opt,name=unauthenticated",
+		Filename:      "goapi/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FileOptions)(nil),
+		ExtensionType: (*Envelope)(nil),
+		Field:         51201,
+		Name:          "goapi.file_envelope",
+		Tag:           "bytes,51201,opt,name=file_envelope",
+		Filename:      "goapi/annotations.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.ServiceOptions)(nil),
+		ExtensionType: (*Envelope)(nil),
+		Field:         51201,
+		Name:          "goapi.envelope",
+		Tag:           "bytes,51201,opt,name=envelope",
+		Filename:      "goapi/annotations.proto",
+	},
+}
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// unauthenticated 标记方法不需要认证，生成的代码调用时不会带上认证信息
+	//
+	//     rpc Login(LoginRequest) returns (LoginResponse) {
+	//       option (goapi.unauthenticated) = true;
+	//     }
+	//
+	// optional bool unauthenticated = 51201;
+	E_Unauthenticated = &file_goapi_annotations_proto_extTypes[0]
+)
+
+// Extension fields to descriptorpb.FileOptions.
+var (
+	// file_envelope 文件里所有服务的返回外层结构
+	//
+	//     option (goapi.file_envelope) = { code_field: "errcode" message_field: "errmsg" };
+	//
+	// optional goapi.Envelope file_envelope = 51201;
+	E_FileEnvelope = &file_goapi_annotations_proto_extTypes[1]
+)
+
+// Extension fields to descriptorpb.ServiceOptions.
+var (
+	// envelope 服务的返回外层结构，覆盖 file_envelope
+	//
+	// optional goapi.Envelope envelope = 51201;
+	E_Envelope = &file_goapi_annotations_proto_extTypes[2]
+)
+
+var File_goapi_annotations_proto protoreflect.FileDescriptor
+
+var file_goapi_annotations_proto_rawDesc = []byte{
+	0x0a, 0x17, 0x67, 0x6f, 0x61, 0x70, 0x69, 0x2f, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x05, 0x67, 0x6f, 0x61, 0x70, 0x69,
+	0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x22, 0x92, 0x01, 0x0a, 0x08, 0x45, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x12,
+	0x1d, 0x0a, 0x0a, 0x63, 0x6f, 0x64, 0x65, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x6f, 0x64, 0x65, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x23,
+	0x0a, 0x0d, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x46, 0x69,
+	0x65, 0x6c, 0x64, 0x12, 0x23, 0x0a, 0x0d, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x5f, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x73, 0x75, 0x63, 0x63,
+	0x65, 0x73, 0x73, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x64, 0x61, 0x74, 0x61,
+	0x5f, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x61,
+	0x74, 0x61, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x3a, 0x4a, 0x0a, 0x0f, 0x75, 0x6e, 0x61, 0x75, 0x74,
+	0x68, 0x65, 0x6e, 0x74, 0x69, 0x63, 0x61, 0x74, 0x65, 0x64, 0x12, 0x1e, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x74,
+	0x68, 0x6f, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x81, 0x90, 0x03, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x0f, 0x75, 0x6e, 0x61, 0x75, 0x74, 0x68, 0x65, 0x6e, 0x74, 0x69, 0x63, 0x61,
+	0x74, 0x65, 0x64, 0x3a, 0x54, 0x0a, 0x0d, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x65, 0x6e, 0x76, 0x65,
+	0x6c, 0x6f, 0x70, 0x65, 0x12, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x18, 0x81, 0x90, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x67, 0x6f, 0x61,
+	0x70, 0x69, 0x2e, 0x45, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x52, 0x0c, 0x66, 0x69, 0x6c,
+	0x65, 0x45, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x3a, 0x4e, 0x0a, 0x08, 0x65, 0x6e, 0x76,
+	0x65, 0x6c, 0x6f, 0x70, 0x65, 0x12, 0x1f, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4f,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x81, 0x90, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f,
+	0x2e, 0x67, 0x6f, 0x61, 0x70, 0x69, 0x2e, 0x45, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x52,
+	0x08, 0x65, 0x6e, 0x76, 0x65, 0x6c, 0x6f, 0x70, 0x65, 0x42, 0x36, 0x5a, 0x34, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x64, 0x65, 0x76, 0x2d, 0x6f, 0x70, 0x65, 0x6e,
+	0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x2d, 0x67, 0x65, 0x6e, 0x2d, 0x67,
+	0x6f, 0x5f, 0x61, 0x70, 0x69, 0x2f, 0x67, 0x6f, 0x61, 0x70, 0x69, 0x3b, 0x67, 0x6f, 0x61, 0x70,
+	0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_goapi_annotations_proto_rawDescOnce sync.Once
+	file_goapi_annotations_proto_rawDescData = file_goapi_annotations_proto_rawDesc
+)
+
+func file_goapi_annotations_proto_rawDescGZIP() []byte {
+	file_goapi_annotations_proto_rawDescOnce.Do(func() {
+		file_goapi_annotations_proto_rawDescData = protoimpl.X.CompressGZIP(file_goapi_annotations_proto_rawDescData)
+	})
+	return file_goapi_annotations_proto_rawDescData
+}
+
+var file_goapi_annotations_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_goapi_annotations_proto_goTypes = []interface{}{
+	(*Envelope)(nil),                    // 0: goapi.Envelope
+	(*descriptorpb.MethodOptions)(nil),  // 1: google.protobuf.MethodOptions
+	(*descriptorpb.FileOptions)(nil),    // 2: google.protobuf.FileOptions
+	(*descriptorpb.ServiceOptions)(nil), // 3: google.protobuf.ServiceOptions
+}
+var file_goapi_annotations_proto_depIdxs = []int32{
+	1, // 0: goapi.unauthenticated:extendee -> google.protobuf.MethodOptions
+	2, // 1: goapi.file_envelope:extendee -> google.protobuf.FileOptions
+	3, // 2: goapi.envelope:extendee -> google.protobuf.ServiceOptions
+	0, // 3: goapi.file_envelope:type_name -> goapi.Envelope
+	0, // 4: goapi.envelope:type_name -> goapi.Envelope
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	3, // [3:5] is the sub-list for extension type_name
+	0, // [0:3] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_goapi_annotations_proto_init() }
+func file_goapi_annotations_proto_init() {
+	if File_goapi_annotations_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_goapi_annotations_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Envelope); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_goapi_annotations_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 3,
+			NumServices:   0,
+		},
+		GoTypes:           file_goapi_annotations_proto_goTypes,
+		DependencyIndexes: file_goapi_annotations_proto_depIdxs,
+		MessageInfos:      file_goapi_annotations_proto_msgTypes,
+		ExtensionInfos:    file_goapi_annotations_proto_extTypes,
+	}.Build()
+	File_goapi_annotations_proto = out.File
+	file_goapi_annotations_proto_rawDesc = nil
+	file_goapi_annotations_proto_goTypes = nil
+	file_goapi_annotations_proto_depIdxs = nil
+}
@@ -1,13 +1,15 @@
 package genapi
 
 import (
-	"regexp"
-
 	"github.com/golang/protobuf/protoc-gen-go/descriptor"
 )
 
 type restInfo struct {
 	verb, route, body, typ string
+	// responseBody 是 response_body 指定的返回字段
+	responseBody string
+	// xmlRoot 是 xml body 的根元素名，为空时使用body消息的名字
+	xmlRoot string
 }
 
 const (
@@ -15,6 +17,8 @@ const (
 	BODY_FORM  = "form"
 	BODY_MULTI = "multi"
 	BODY_BYTE  = "byte"
+	BODY_HTTP  = "http"
+	BODY_XML   = "xml"
 )
 
 const (
@@ -51,5 +55,3 @@ var wellKnownTypes = []string{
 	".google.protobuf.Value",
 	".google.protobuf.ListValue",
 }
-
-var httpPatternVarRegex = regexp.MustCompile(`{([a-zA-Z0-9_.]+?)(=[^{}]+)?}`)
@@ -1,31 +1,58 @@
 package genapi
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dev-openapi/protoc-gen-go_api/internal/pbinfo"
+)
 
 var (
+	// fn 模板里可以使用的函数
 	fn = map[string]interface{}{
-		"unexport": unexport,
-		"html":     html,
+		"unexport":   unexport,
+		"export":     export,
+		"html":       html,
+		"camel":      snakeToCamel,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"join":       strings.Join,
+		"replace":    strings.ReplaceAll,
+		"contains":   strings.Contains,
+		"hasPrefix":  strings.HasPrefix,
+		"hasSuffix":  strings.HasSuffix,
+		"trimPrefix": strings.TrimPrefix,
+		"trimSuffix": strings.TrimSuffix,
+		"quote":      strconv.Quote,
 	}
 )
 
 var (
-	noClientStream = `return nil, fmt.Errorf("%s not yet supported for REST clients")`
-	noServerStream = `return nil, fmt.Errorf("%s not yet supported for REST servers")`
+	noBidiStream   = `return nil, fmt.Errorf("%s bidirectional streaming not yet supported for REST clients")`
 	noRestyOptions = `return nil, fmt.Errorf("%s has no resty options")`
 )
 
 type FileData struct {
-	Version   string         // 版本号
-	Source    string         // 源文件
-	GoPackage string         // Go包名
-	Services  []*ServiceData // 服务数据
+	Version   string              // 版本号
+	Source    string              // 源文件
+	GoPackage string              // Go包名
+	Imports   []pbinfo.ImportSpec // 其他包的引用
+	Services  []*ServiceData      // 服务数据
 }
 
 type ServiceData struct {
 	PkgName  string        // package name
 	ServName string        // 服务名，不带Service的
 	Methods  []*MethodData // 方法数据
+	// 返回的业务外层结构，由 goapi.envelope 或 goapi.file_envelope 指定
+	Envelope *EnvelopeData
+}
+
+type EnvelopeData struct {
+	CodeField    string // 业务码字段名
+	MessageField string // 错误信息字段名
+	SuccessValue string // 表示成功的业务码
+	DataField    string // 数据字段名，可以为空
 }
 
 type MethodData struct {
@@ -35,18 +62,73 @@ type MethodData struct {
 	ReqTyp   string // 请求类型名
 	ResTyp   string // 返回类型名
 	ReqCode  string // 请求代码
+	// 是否是服务端流式方法
+	ServerStream bool
+	// 是否是客户端流式方法
+	ClientStream bool
+	// 长时间运行操作，返回google.longrunning.Operation且有operation_info时不为空
+	LRO *LROData
+	// 分页迭代器，符合AIP-158的List方法不为空
+	Page *PageData
+}
+
+type LROData struct {
+	ResTyp  string // operation_info 的 response_type 类型名
+	MetaTyp string // operation_info 的 metadata_type 类型名，可以为空
+	Prefix  string // Operations REST 接口的版本前缀，如 /v1
+}
+
+type PageData struct {
+	ItemTyp    string // 分页元素的类型名，消息是指针类型，如 *Book
+	ItemsField string // 返回里分页元素字段的go名字，如 Books
+}
+
+type RequestData struct {
+	ServName string      // 服务名，proto里的原名
+	MethName string      // 方法名
+	ResTyp   string      // 返回类型名
+	Bindings []*CodeData // http绑定，第一个是主绑定，其余是additional_bindings
+	// 是否是服务端流式方法
+	ServerStream bool
+	// 是否是客户端流式方法
+	ClientStream bool
+	// 是否有绑定指定了response_body
+	HasResponseBody bool
+	// 方法标记了 (goapi.unauthenticated)，不带认证信息
+	Unauthenticated bool
+	// 插件参数指定的默认超时时间的go代码，如 30 * time.Second，没有时为空
+	Timeout string
 }
 
 type CodeData struct {
-	Verb      string
-	RouteCode string
-	BodyCode  string
-	QueryCode string
+	Verb      string // http方法
+	Route     string // 路由模板
+	RouteCode string // 生成rawURL的代码
+	BodyCode  string // 生成body的代码，没有body时为空
+	QueryCode string // 生成query参数的代码
+	// response_body 指定的返回字段，为空时整个body解析到返回类型
+	ResponseBody string
+	// 方法标记了 (goapi.unauthenticated)，不带 query token
+	Unauthenticated bool
 }
 
 type OptionData struct {
-	GoPackage string
-	Version   string
+	GoPackage string // Go包名
+	Version   string // 版本号
+	FileName  string // 输出文件名
+	// 长时间运行操作默认的轮询间隔
+	PollInitialDelay string
+	PollMaxDelay     string
+	// 关闭默认超时的环境变量
+	DisableDeadlinesVar string
+}
+
+// export 把首字母转大写
+func export(s string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
 }
 
 // unexport 把首字母转小写
@@ -0,0 +1,40 @@
+package genapi
+
+import (
+	"fmt"
+
+	"github.com/dev-openapi/protoc-gen-go_api/goapi"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultSuccessValue 没有指定 success_value 时表示成功的业务码
+const defaultSuccessValue = "0"
+
+// buildEnvelopeData returns the response envelope of the service, goapi.envelope of the service
+// overrides goapi.file_envelope of the file, nil if neither is set.
+func buildEnvelopeData(fd *descriptor.FileDescriptorProto, serv *descriptor.ServiceDescriptorProto) (*EnvelopeData, error) {
+	var env *goapi.Envelope
+	if fd.GetOptions() != nil && proto.HasExtension(fd.GetOptions(), goapi.E_FileEnvelope) {
+		env, _ = proto.GetExtension(fd.GetOptions(), goapi.E_FileEnvelope).(*goapi.Envelope)
+	}
+	if serv.GetOptions() != nil && proto.HasExtension(serv.GetOptions(), goapi.E_Envelope) {
+		env, _ = proto.GetExtension(serv.GetOptions(), goapi.E_Envelope).(*goapi.Envelope)
+	}
+	if env == nil {
+		return nil, nil
+	}
+	if len(env.GetCodeField()) == 0 {
+		return nil, fmt.Errorf("%s: envelope of service %s must have code_field", fd.GetName(), serv.GetName())
+	}
+	data := &EnvelopeData{
+		CodeField:    env.GetCodeField(),
+		MessageField: env.GetMessageField(),
+		SuccessValue: env.GetSuccessValue(),
+		DataField:    env.GetDataField(),
+	}
+	if len(data.SuccessValue) == 0 {
+		data.SuccessValue = defaultSuccessValue
+	}
+	return data, nil
+}
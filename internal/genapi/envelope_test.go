@@ -0,0 +1,78 @@
+package genapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+const envelopeProto = `
+name: "wx.proto"
+package: "wx.v1"
+dependency: "goapi/annotations.proto"
+message_type {
+  name: "LoginRequest"
+  field { name: "code" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "code" }
+}
+service {
+  name: "AuthService"
+  method {
+    name: "Login" input_type: ".wx.v1.LoginRequest" output_type: ".wx.v1.LoginRequest"
+    options { [google.api.http] { get: "/sns/login" } }
+  }
+}
+service {
+  name: "PayService"
+  method {
+    name: "Pay" input_type: ".wx.v1.LoginRequest" output_type: ".wx.v1.LoginRequest"
+    options { [google.api.http] { post: "/pay" body: "*" } }
+  }
+  options { [goapi.envelope] { code_field: "code" message_field: "msg" success_value: "SUCCESS" data_field: "data" } }
+}
+service {
+  name: "PlainService"
+  method {
+    name: "Get" input_type: ".wx.v1.LoginRequest" output_type: ".wx.v1.LoginRequest"
+    options { [google.api.http] { get: "/plain" } }
+  }
+}
+options { go_package: "example.com/wx;wx" [goapi.file_envelope] { code_field: "errcode" message_field: "errmsg" } }
+syntax: "proto3"
+`
+
+func TestGenEnvelope(t *testing.T) {
+	code := genFiles(t, "", envelopeProto)["example.com/wx/wx.api.go"]
+	for _, want := range []string{
+		// file_envelope with the default success value
+		"opt.envelope = &envelope{\n\t\tcodeField:    \"errcode\",\n\t\tmessageField: \"errmsg\",\n\t\tsuccessValue: \"0\",\n\t\tdataField:    \"\",\n\t}",
+		// envelope of the service overrides file_envelope
+		"opt.envelope = &envelope{\n\t\tcodeField:    \"code\",\n\t\tmessageField: \"msg\",\n\t\tsuccessValue: \"SUCCESS\",\n\t\tdataField:    \"data\",\n\t}",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %s:\n%s", want, code)
+		}
+	}
+	if n := strings.Count(code, "opt.envelope = &envelope{"); n != 3 {
+		t.Errorf("want the envelope of 3 services, got %d", n)
+	}
+
+	code = genFiles(t, "", strings.Replace(envelopeProto, ` [goapi.file_envelope] { code_field: "errcode" message_field: "errmsg" }`, "", 1))["example.com/wx/wx.api.go"]
+	if n := strings.Count(code, "opt.envelope = &envelope{"); n != 1 {
+		t.Errorf("want the envelope of PayService only, got %d", n)
+	}
+}
+
+func TestGenEnvelopeMissingCodeField(t *testing.T) {
+	fd := &descriptor.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(strings.Replace(envelopeProto, `code_field: "errcode" `, "", 1)), fd); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Gen(&plugin.CodeGeneratorRequest{ProtoFile: []*descriptor.FileDescriptorProto{fd}, FileToGenerate: []string{fd.GetName()}, Parameter: proto.String("")})
+	if err == nil || !strings.Contains(err.Error(), "envelope of service AuthService must have code_field") {
+		t.Errorf("err = %v", err)
+	}
+}
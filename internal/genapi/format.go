@@ -0,0 +1,49 @@
+package genapi
+
+import (
+	"errors"
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"strings"
+)
+
+// snippetLines 出错时前后展示的行数
+const snippetLines = 3
+
+// formatCode runs gofmt on the generated go source,
+// if the source is not valid go the error shows the offending snippet.
+func formatCode(src string) (string, error) {
+	bs, err := format.Source([]byte(src))
+	if err != nil {
+		return "", fmt.Errorf("%v\n%s", err, codeSnippet(src, err))
+	}
+	return string(bs), nil
+}
+
+// checkMethodCode checks the body of a generated method is valid go.
+func checkMethodCode(code string) error {
+	_, err := formatCode("package p\n\nfunc _() {\n" + code + "\n}\n")
+	return err
+}
+
+func codeSnippet(src string, err error) string {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) || len(list) == 0 {
+		return ""
+	}
+	line := list[0].Pos.Line
+	lines := strings.Split(src, "\n")
+	b := strings.Builder{}
+	for i := line - snippetLines; i <= line+snippetLines; i++ {
+		if i < 1 || i > len(lines) {
+			continue
+		}
+		mark := " "
+		if i == line {
+			mark = ">"
+		}
+		b.WriteString(fmt.Sprintf("%s%4d | %s\n", mark, i, lines[i-1]))
+	}
+	return b.String()
+}
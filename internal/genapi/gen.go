@@ -2,6 +2,7 @@ package genapi
 
 import (
 	"fmt"
+	"log"
 	"path"
 	"strings"
 
@@ -13,24 +14,35 @@ import (
 func Gen(req *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error) {
 	initDescInfo(req)
 	initComment(req)
+	if err := initOperationInfo(req); err != nil {
+		return nil, err
+	}
 	opts, err := parseOptions(req.Parameter)
 	if err != nil {
 		return nil, err
 	}
+	for f, pkg := range opts.pkgOverrides {
+		descInfo.PkgOverrides[f] = pkg
+	}
+	if len(opts.templateDir) > 0 {
+		if err := loadTemplates(opts.templateDir); err != nil {
+			return nil, err
+		}
+	}
 	var resp plugin.CodeGeneratorResponse
-	optdata := &OptionData{}
-	var fname string
+	// 每个go包和输出目录生成一个option.go
+	var optKeys []string
+	optdatas := map[string]*OptionData{}
+	// 所有生成的rpc，用来检查method_timeout
+	rpcs := map[string]bool{}
 	for _, f := range req.GetProtoFile() {
 		if !strContains(req.GetFileToGenerate(), f.GetName()) {
 			continue
 		}
-		data, err := parseRestFile(f)
+		data, err := parseRestFile(f, opts)
 		if err != nil {
 			return nil, err
 		}
-		if len(optdata.GoPackage) == 0 {
-			optdata.GoPackage = data.GoPackage
-		}
 		if len(data.Services) <= 0 {
 			continue
 		}
@@ -38,63 +50,99 @@ func Gen(req *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error
 		if err != nil {
 			return nil, err
 		}
-		name := fmt.Sprintf("%s.api.go", strings.ReplaceAll(f.GetName(), ".proto", ""))
-		if len(fname) <= 0 {
-			fname = path.Dir(f.GetName())
+		bs, err = formatCode(bs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: generated invalid go code: %v", f.GetName(), err)
 		}
-		if len(opts.out) > 0 {
-			name = path.Join(opts.out, name)
+		name, err := opts.outputName(f, ".api.go")
+		if err != nil {
+			return nil, err
 		}
 		resp.File = append(resp.File, &plugin.CodeGeneratorResponse_File{
 			Name:    proto.String(name),
 			Content: proto.String(bs),
 		})
+
+		fname := path.Join(path.Dir(name), "option.go")
+		key := goImportPath(f) + "|" + fname
+		if _, ok := optdatas[key]; !ok {
+			optKeys = append(optKeys, key)
+			optdatas[key] = &OptionData{
+				GoPackage:           data.GoPackage,
+				Version:             Version,
+				FileName:            fname,
+				PollInitialDelay:    defaultPollInitialDelay,
+				PollMaxDelay:        defaultPollMaxDelay,
+				DisableDeadlinesVar: disableDeadlinesVar,
+			}
+		}
+		for _, serv := range f.GetService() {
+			for _, meth := range serv.GetMethod() {
+				rpcs[serv.GetName()+"."+meth.GetName()] = true
+			}
+		}
 	}
-	optdata.Version = Version
-	bs, err := buildOptionsCode(optdata)
-	if err != nil {
-		return nil, err
+	for method := range opts.methodTimeouts {
+		if !rpcs[method] {
+			// 同一个go包的文件可能分多次生成，rpc可能在其他文件里
+			log.Printf("plugin option method_timeout: rpc %s is not generated in this run, ignored", method)
+		}
 	}
-	if len(opts.out) > 0 {
-		fname = path.Join(opts.out, fname, "option.go")
+	for _, key := range optKeys {
+		optdata := optdatas[key]
+		bs, err := buildOptionsCode(optdata)
+		if err != nil {
+			return nil, err
+		}
+		bs, err = formatCode(bs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: generated invalid go code: %v", optdata.FileName, err)
+		}
+		resp.File = append(resp.File, &plugin.CodeGeneratorResponse_File{
+			Name:    proto.String(optdata.FileName),
+			Content: proto.String(bs),
+		})
 	}
-	resp.File = append(resp.File, &plugin.CodeGeneratorResponse_File{
-		Name:    proto.String(fname),
-		Content: proto.String(bs),
-	})
 	return &resp, nil
 }
 
-func parseRestFile(fd *descriptor.FileDescriptorProto) (*FileData, error) {
-	pkg := fd.Options.GetGoPackage()
-	ps := strings.Split(pkg, "/")
+func parseRestFile(fd *descriptor.FileDescriptorProto, opts *options) (*FileData, error) {
+	if len(goImportPath(fd)) == 0 {
+		return nil, fmt.Errorf("%s: unable to determine go import path, missing option go_package or M%s=<importpath>", fd.GetName(), fd.GetName())
+	}
 	data := &FileData{
 		Version:   Version,
 		Source:    fd.GetName(),
-		GoPackage: strings.ReplaceAll(ps[len(ps)-1], "-", "_"),
+		GoPackage: goPackageName(fd),
 	}
 	servs := fd.GetService()
+	imps := newImportSet(fd)
 
 	for _, serv := range servs {
-		srv, err := parseRestService(fd, serv)
+		srv, err := parseRestService(fd, serv, imps, opts)
 		if err != nil {
 			return nil, err
 		}
 		data.Services = append(data.Services, srv)
 	}
+	data.Imports = imps.specs()
 
 	return data, nil
 }
 
-func parseRestService(fd *descriptor.FileDescriptorProto, serv *descriptor.ServiceDescriptorProto) (*ServiceData, error) {
+func parseRestService(fd *descriptor.FileDescriptorProto, serv *descriptor.ServiceDescriptorProto, imps *importSet, opts *options) (*ServiceData, error) {
 	data := &ServiceData{
 		PkgName:  fd.GetPackage(),
 		ServName: strings.ReplaceAll(serv.GetName(), "Service", ""),
 	}
+	var err error
+	if data.Envelope, err = buildEnvelopeData(fd, serv); err != nil {
+		return nil, err
+	}
 
 	meths := serv.GetMethod()
 	for _, meth := range meths {
-		mth, err := parseRestMethod(fd, serv, meth)
+		mth, err := parseRestMethod(fd, serv, meth, imps, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -104,25 +152,46 @@ func parseRestService(fd *descriptor.FileDescriptorProto, serv *descriptor.Servi
 	return data, nil
 }
 
-func parseRestMethod(fd *descriptor.FileDescriptorProto, serv *descriptor.ServiceDescriptorProto, meth *descriptor.MethodDescriptorProto) (*MethodData, error) {
+func parseRestMethod(fd *descriptor.FileDescriptorProto, serv *descriptor.ServiceDescriptorProto, meth *descriptor.MethodDescriptorProto, imps *importSet, opts *options) (*MethodData, error) {
+	reqTyp, err := imps.typeName(meth.GetInputType())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", meth.GetName(), err)
+	}
+	resTyp, err := imps.typeName(meth.GetOutputType())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", meth.GetName(), err)
+	}
 	data := &MethodData{
 		ServName: strings.ReplaceAll(serv.GetName(), "Service", ""),
 		MethName: meth.GetName(),
 		Comment:  getComment(meth),
-		ReqTyp:   typeName(meth.GetInputType()),
-		ResTyp:   typeName(meth.GetOutputType()),
+		ReqTyp:   reqTyp,
+		ResTyp:   resTyp,
 	}
 	data.Comment = strings.ReplaceAll(data.Comment, "\n", "\n\t//")
+	if data.LRO, err = buildLROData(fd, meth, imps); err != nil {
+		return nil, err
+	}
+	if data.Page, err = buildPageData(meth, imps); err != nil {
+		return nil, err
+	}
 	switch {
-	case meth.GetClientStreaming():
-		data.ReqCode = fmt.Sprintf(noClientStream, meth.GetName())
-	case meth.GetServerStreaming():
-		data.ReqCode = fmt.Sprintf(noServerStream, meth.GetName())
+	case meth.GetClientStreaming() && meth.GetServerStreaming():
+		data.ReqCode = fmt.Sprintf(noBidiStream, meth.GetName())
 	default:
-		code, err := genRestMethodCode(fd, serv, meth)
+		data.ClientStream = meth.GetClientStreaming()
+		data.ServerStream = meth.GetServerStreaming()
+		var timeout string
+		if d := opts.timeout(serv, meth); d > 0 && !data.ClientStream && !data.ServerStream {
+			timeout = durationCode(d)
+		}
+		code, err := genRestMethodCode(fd, serv, meth, resTyp, timeout)
 		if err != nil {
 			return nil, err
 		}
+		if err := checkMethodCode(code); err != nil {
+			return nil, fmt.Errorf("%s: rpc %s.%s generated invalid go code: %v", fd.GetName(), serv.GetName(), meth.GetName(), err)
+		}
 		data.ReqCode = code
 	}
 
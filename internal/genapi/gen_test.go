@@ -0,0 +1,195 @@
+package genapi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	_ "github.com/dev-openapi/protoc-gen-go_api/goapi"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+)
+
+const commonProto = `
+name: "common/v1/common.proto"
+package: "common.v1"
+message_type {
+  name: "Pagination"
+  field { name: "page" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "page" }
+}
+options { go_package: "example.com/foo/common/v1" }
+syntax: "proto3"
+`
+
+const demoProto = `
+name: "demo/v1/demo.proto"
+package: "demo.v1"
+dependency: "common/v1/common.proto"
+message_type {
+  name: "GetUserRequest"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+}
+service {
+  name: "UserService"
+  method {
+    name: "GetUser" input_type: ".demo.v1.GetUserRequest" output_type: ".common.v1.Pagination"
+    options { [google.api.http] { get: "/v1/{name=users/*}" } }
+  }
+  method {
+    name: "ListUsers" input_type: ".common.v1.Pagination" output_type: ".demo.v1.GetUserRequest"
+    options { [google.api.http] { post: "/v1/users" body: "*" } }
+  }
+}
+options { go_package: "example.com/foo/demo/v1" }
+syntax: "proto3"
+`
+
+// genFiles runs the plugin on the text format file descriptors, the last file is generated.
+func genFiles(t *testing.T, param string, files ...string) map[string]string {
+	t.Helper()
+	var fds []*descriptor.FileDescriptorProto
+	for _, f := range files {
+		fd := &descriptor.FileDescriptorProto{}
+		if err := prototext.Unmarshal([]byte(f), fd); err != nil {
+			t.Fatalf("parse file descriptor: %v", err)
+		}
+		fds = append(fds, fd)
+	}
+	return genDescriptors(t, param, fds...)
+}
+
+// genDescriptors runs the plugin on the file descriptors, the last file is generated.
+// The request is marshaled and unmarshaled like it is read from protoc.
+func genDescriptors(t *testing.T, param string, fds ...*descriptor.FileDescriptorProto) map[string]string {
+	t.Helper()
+	bs, err := proto.Marshal(&plugin.CodeGeneratorRequest{
+		Parameter:      proto.String(param),
+		ProtoFile:      fds,
+		FileToGenerate: []string{fds[len(fds)-1].GetName()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &plugin.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(bs, req); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Gen(req)
+	if err != nil {
+		t.Fatalf("Gen: %v", err)
+	}
+	out := map[string]string{}
+	for _, f := range resp.GetFile() {
+		out[f.GetName()] = f.GetContent()
+	}
+	return out
+}
+
+func TestGenVersionedImport(t *testing.T) {
+	out := genFiles(t, "", commonProto, demoProto)
+	code, ok := out["example.com/foo/demo/v1/demo.api.go"]
+	if !ok {
+		t.Fatalf("demo.api.go not generated, got %v", keys(out))
+	}
+	if !strings.Contains(code, `commonpb "example.com/foo/common/v1"`) {
+		t.Errorf("want import of example.com/foo/common/v1 as commonpb, got:\n%s", code)
+	}
+	if strings.Contains(code, `"example.com/foo/demo/v1"`) || strings.Contains(code, "demopb.") {
+		t.Errorf("types of the generated package must not be imported, got:\n%s", code)
+	}
+	if !strings.Contains(code, "*commonpb.Pagination") || !strings.Contains(code, "*GetUserRequest") {
+		t.Errorf("want qualified commonpb.Pagination and local GetUserRequest, got:\n%s", code)
+	}
+}
+
+func keys(m map[string]string) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func TestGenTimeout(t *testing.T) {
+	out := genFiles(t, "default_timeout=30s,method_timeout=UserService.ListUsers:500ms,method_timeout=OtherService.Get:1s", commonProto, demoProto)
+	code := out["example.com/foo/demo/v1/demo.api.go"]
+	for _, want := range []string{
+		"ctx, cancel := opt.withTimeout(ctx, 30*time.Second)",
+		"ctx, cancel := opt.withTimeout(ctx, 500*time.Millisecond)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %s:\n%s", want, code)
+		}
+	}
+	if opt := out["example.com/foo/demo/v1/option.go"]; strings.Contains(opt, "ListUsers") || strings.Contains(opt, "500*time.Millisecond") {
+		t.Errorf("option.go must not depend on the rpcs of the run:\n%s", opt)
+	}
+
+	code = genFiles(t, "", commonProto, demoProto)["example.com/foo/demo/v1/demo.api.go"]
+	if strings.Count(code, "ctx, cancel := opt.withTimeout(ctx, 0)") != 2 {
+		t.Errorf("want no default timeout without the plugin options:\n%s", code)
+	}
+}
+
+const verbProto = `
+name: "verb.proto"
+package: "verb.v1"
+message_type {
+  name: "User"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+}
+service {
+  name: "UserService"
+  method {
+    name: "DeleteUser" input_type: ".verb.v1.User" output_type: ".verb.v1.User"
+    options { [google.api.http] { delete: "/v1/{name=users/*}" } }
+  }
+  method {
+    name: "UpdateUser" input_type: ".verb.v1.User" output_type: ".verb.v1.User"
+    options { [google.api.http] { put: "/v1/{name=users/*}" body: "*" } }
+  }
+  method {
+    name: "PurgeUser" input_type: ".verb.v1.User" output_type: ".verb.v1.User"
+    options { [google.api.http] { custom { kind: "purge" path: "/v1/{name=users/*}:purge" } } }
+  }
+}
+options { go_package: "example.com/verb;verb" }
+syntax: "proto3"
+`
+
+func TestGenVerbs(t *testing.T) {
+	code := genFiles(t, "", verbProto)["example.com/verb/verb.api.go"]
+	for _, want := range []string{
+		"call.Route, call.Verb = \"/v1/{name=users/*}\", \"DELETE\"",
+		"req, err = http.NewRequestWithContext(ctx, \"DELETE\", rawURL, nil)",
+		// the route of put is not taken as the verb
+		"call.Route, call.Verb = \"/v1/{name=users/*}\", \"PUT\"",
+		"req, err = http.NewRequestWithContext(ctx, \"PUT\", rawURL, body)",
+		// the custom kind is the upper case http method
+		"call.Route, call.Verb = \"/v1/{name=users/*}:purge\", \"PURGE\"",
+		"rawURL := fmt.Sprintf(\"%s/v1/%s:purge\", opt.addr, escapePath(pathName, true))",
+		"req, err = http.NewRequestWithContext(ctx, \"PURGE\", rawURL, nil)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %s:\n%s", want, code)
+		}
+	}
+}
+
+func TestGenCustomVerbError(t *testing.T) {
+	for _, kind := range []string{"", "GET /X", "PUR(GE"} {
+		fd := &descriptor.FileDescriptorProto{}
+		text := strings.Replace(verbProto, `kind: "purge"`, fmt.Sprintf("kind: %q", kind), 1)
+		if err := prototext.Unmarshal([]byte(text), fd); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Gen(&plugin.CodeGeneratorRequest{ProtoFile: []*descriptor.FileDescriptorProto{fd}, FileToGenerate: []string{fd.GetName()}, Parameter: proto.String("")})
+		if want := fmt.Sprintf("PurgeUser: custom http kind %q is not a valid http method", kind); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("kind %q: err = %v, want %s", kind, err, want)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package genapi
 
 import (
 	"fmt"
+	"go/token"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 func strContains(a []string, s string) bool {
@@ -15,11 +17,6 @@ func strContains(a []string, s string) bool {
 	return false
 }
 
-func typeName(str string) string {
-	sp := strings.Split(str, ".")
-	return sp[len(sp)-1]
-}
-
 // Given a chained description for a field in a proto message,
 // e.g. squid.mantle.mass_kg
 // return the string description of the go expression
@@ -83,3 +80,20 @@ func snakeToCamel(s string) string {
 	}
 	return sb.String()
 }
+
+// goSanitized converts s into a valid go identifier the same way protoc-gen-go does,
+// e.g. foo-bar -> foo_bar, 2d -> _2d.
+func goSanitized(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, s)
+
+	r, _ := utf8.DecodeRuneInString(s)
+	if token.Lookup(s).IsKeyword() || !unicode.IsLetter(r) {
+		return "_" + s
+	}
+	return s
+}
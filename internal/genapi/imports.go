@@ -0,0 +1,98 @@
+package genapi
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dev-openapi/protoc-gen-go_api/internal/pbinfo"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// reservedImports 模板里固定引入的包名，其他包的别名不能和它们冲突
+var reservedImports = []string{"context", "fmt", "io", "json", "bytes", "http", "strings", "url", "multipart", "time", "proto"}
+
+// importSet collects the go imports needed by the types referenced from one generated file.
+type importSet struct {
+	self    string            // 当前文件的 import path
+	aliases map[string]string // import path -> alias
+	used    map[string]bool   // 已经使用的别名
+}
+
+func newImportSet(fd *descriptor.FileDescriptorProto) *importSet {
+	s := &importSet{
+		self:    goImportPath(fd),
+		aliases: map[string]string{},
+		used:    map[string]bool{},
+	}
+	for _, r := range reservedImports {
+		s.used[r] = true
+	}
+	return s
+}
+
+// typeName returns the go expression of a fully qualified proto type, such as
+// .common.v1.Pagination -> commonpb.Pagination, nested messages are named Outer_Inner.
+func (s *importSet) typeName(typ string) (string, error) {
+	t, ok := descInfo.Type[typ]
+	if !ok {
+		return "", fmt.Errorf("unknown type %s", typ)
+	}
+	name, imp, err := descInfo.NameSpec(t)
+	if err != nil {
+		return "", err
+	}
+	if imp.Path == s.self {
+		return name, nil
+	}
+	return s.alias(imp) + "." + name, nil
+}
+
+func (s *importSet) alias(imp pbinfo.ImportSpec) string {
+	if a, ok := s.aliases[imp.Path]; ok {
+		return a
+	}
+	base := strings.NewReplacer("-", "_", ".", "_").Replace(imp.Name)
+	a := base
+	for i := 1; s.used[a]; i++ {
+		a = fmt.Sprintf("%s%d", base, i)
+	}
+	s.aliases[imp.Path] = a
+	s.used[a] = true
+	return a
+}
+
+// specs returns the collected imports sorted by path.
+func (s *importSet) specs() []pbinfo.ImportSpec {
+	specs := make([]pbinfo.ImportSpec, 0, len(s.aliases))
+	for p, a := range s.aliases {
+		specs = append(specs, pbinfo.ImportSpec{Name: a, Path: p})
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Path < specs[j].Path })
+	return specs
+}
+
+// goImportPath go_package 里的 import path，去掉 ;name 部分
+func goImportPath(fd *descriptor.FileDescriptorProto) string {
+	pkg := fd.GetOptions().GetGoPackage()
+	if p, ok := descInfo.PkgOverrides[fd.GetName()]; ok {
+		pkg = p
+	}
+	if p := strings.IndexByte(pkg, ';'); p >= 0 {
+		return pkg[:p]
+	}
+	return pkg
+}
+
+// goPackageName go 包名，优先用 go_package 里 ; 后面的名字，否则用 import path 的最后一段
+func goPackageName(fd *descriptor.FileDescriptorProto) string {
+	pkg := fd.GetOptions().GetGoPackage()
+	if p, ok := descInfo.PkgOverrides[fd.GetName()]; ok {
+		pkg = p
+	}
+	if p := strings.IndexByte(pkg, ';'); p >= 0 {
+		return goSanitized(pkg[p+1:])
+	}
+	return goSanitized(path.Base(pkg))
+}
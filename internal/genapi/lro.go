@@ -0,0 +1,169 @@
+package genapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// operationInfoName is the full name of the extension of MethodOptions describing long-running operations.
+const operationInfoName protoreflect.FullName = "google.longrunning.operation_info"
+
+// operationInfoType 当前请求里 google.longrunning.operation_info 的扩展类型，没有定义时为 nil
+var operationInfoType protoreflect.ExtensionType
+
+func initOperationInfo(req *plugin.CodeGeneratorRequest) error {
+	operationInfoType = nil
+	if xt, err := protoregistry.GlobalTypes.FindExtensionByName(operationInfoName); err == nil {
+		// google.golang.org/genproto/googleapis/longrunning is linked into the plugin.
+		operationInfoType = xt
+		return nil
+	}
+	xt, err := dynamicOperationInfoType(req.GetProtoFile())
+	if err != nil {
+		return err
+	}
+	operationInfoType = xt
+	return nil
+}
+
+// dynamicOperationInfoType builds the extension type of operation_info from the file defining it
+// in the request, nil if no file defines it.
+func dynamicOperationInfoType(files []*descriptor.FileDescriptorProto) (protoreflect.ExtensionType, error) {
+	byName := map[string]*descriptor.FileDescriptorProto{}
+	var def *descriptor.FileDescriptorProto
+	for _, f := range files {
+		byName[f.GetName()] = f
+		for _, ext := range f.GetExtension() {
+			if protoreflect.FullName(f.GetPackage()).Append(protoreflect.Name(ext.GetName())) == operationInfoName {
+				def = f
+			}
+		}
+	}
+	if def == nil {
+		return nil, nil
+	}
+	// 只解析定义扩展的文件和它的依赖
+	set := &descriptor.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(name string)
+	add = func(name string) {
+		f, ok := byName[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, dep := range f.GetDependency() {
+			add(dep)
+		}
+		set.File = append(set.File, f)
+	}
+	add(def.GetName())
+	reg, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", def.GetName(), err)
+	}
+	d, err := reg.FindDescriptorByName(operationInfoName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", def.GetName(), err)
+	}
+	xd, ok := d.(protoreflect.ExtensionDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not an extension", def.GetName(), operationInfoName)
+	}
+	return dynamicpb.NewExtensionType(xd), nil
+}
+
+// buildLROData returns the operation wrapper data of a method returning
+// google.longrunning.Operation, nil if the method is not a long-running one.
+func buildLROData(fd *descriptor.FileDescriptorProto, meth *descriptor.MethodDescriptorProto, imps *importSet) (*LROData, error) {
+	if meth.GetOutputType() != lroType || meth.GetServerStreaming() || meth.GetClientStreaming() {
+		return nil, nil
+	}
+	resTyp, metaTyp, ok := operationInfo(meth)
+	if !ok {
+		return nil, nil
+	}
+	if len(resTyp) == 0 {
+		return nil, fmt.Errorf("%s: operation_info must have response_type", meth.GetName())
+	}
+	data := &LROData{}
+	var err error
+	if data.ResTyp, err = imps.typeName(qualifiedTypeName(fd, resTyp)); err != nil {
+		return nil, fmt.Errorf("%s: operation_info response_type: %v", meth.GetName(), err)
+	}
+	if len(metaTyp) > 0 {
+		if data.MetaTyp, err = imps.typeName(qualifiedTypeName(fd, metaTyp)); err != nil {
+			return nil, fmt.Errorf("%s: operation_info metadata_type: %v", meth.GetName(), err)
+		}
+	}
+	if rests := buildRestInfos(meth); len(rests) > 0 {
+		data.Prefix = operationsPrefix(rests[0].route)
+	}
+	return data, nil
+}
+
+// operationInfo reads response_type and metadata_type of google.longrunning.operation_info.
+func operationInfo(meth *descriptor.MethodDescriptorProto) (resTyp, metaTyp string, ok bool) {
+	opts, xt := meth.GetOptions(), operationInfoType
+	if opts == nil || xt == nil {
+		return "", "", false
+	}
+	var info protoreflect.Message
+	if proto.HasExtension(opts, xt) {
+		info = proto.GetExtension(opts, xt).(proto.Message).ProtoReflect()
+	} else {
+		// The extension was not known when the request was unmarshaled, it is in the unknown fields.
+		// They are decoded into a dynamic MethodOptions, which resolves the dynamic extension type.
+		b, err := proto.Marshal(opts)
+		if err != nil {
+			return "", "", false
+		}
+		types := new(protoregistry.Types)
+		if err := types.RegisterExtension(xt); err != nil {
+			return "", "", false
+		}
+		dyn := dynamicpb.NewMessage(xt.TypeDescriptor().ContainingMessage())
+		if err := (proto.UnmarshalOptions{Resolver: types}).Unmarshal(b, dyn); err != nil || !dyn.Has(xt.TypeDescriptor()) {
+			return "", "", false
+		}
+		info = dyn.Get(xt.TypeDescriptor()).Message()
+	}
+	fields := info.Descriptor().Fields()
+	if fd := fields.ByName("response_type"); fd != nil {
+		resTyp = info.Get(fd).String()
+	}
+	if fd := fields.ByName("metadata_type"); fd != nil {
+		metaTyp = info.Get(fd).String()
+	}
+	return resTyp, metaTyp, true
+}
+
+// qualifiedTypeName resolves a type name of operation_info, which is relative
+// to the package of the file unless it is fully qualified.
+func qualifiedTypeName(fd *descriptor.FileDescriptorProto, typ string) string {
+	typ = strings.TrimPrefix(typ, ".")
+	if len(fd.GetPackage()) > 0 {
+		if local := "." + fd.GetPackage() + "." + typ; descInfo.Type[local] != nil {
+			return local
+		}
+	}
+	return "." + typ
+}
+
+// operationsPrefix returns the version prefix of the Operations REST endpoint,
+// such as /v1 for the route /v1/{parent=projects/*}/books.
+func operationsPrefix(route string) string {
+	seg := strings.SplitN(strings.TrimPrefix(route, "/"), "/", 2)[0]
+	if len(seg) >= 2 && seg[0] == 'v' && seg[1] >= '0' && seg[1] <= '9' {
+		return "/" + seg
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package genapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const operationsProto = `
+name: "google/longrunning/operations.proto"
+package: "google.longrunning"
+dependency: "google/protobuf/descriptor.proto"
+message_type {
+  name: "Operation"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+  field { name: "done" number: 3 label: LABEL_OPTIONAL type: TYPE_BOOL json_name: "done" }
+}
+message_type {
+  name: "OperationInfo"
+  field { name: "response_type" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "responseType" }
+  field { name: "metadata_type" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "metadataType" }
+}
+extension { name: "operation_info" extendee: ".google.protobuf.MethodOptions" number: 1049 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.longrunning.OperationInfo" json_name: "operationInfo" }
+options { go_package: "example.com/longrunning;longrunningpb" }
+syntax: "proto3"
+`
+
+const lroProto = `
+name: "lro.proto"
+package: "lro.v1"
+dependency: "google/longrunning/operations.proto"
+message_type {
+  name: "Book"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+}
+service {
+  name: "BookService"
+  method {
+    name: "CreateBook" input_type: ".lro.v1.Book" output_type: ".google.longrunning.Operation"
+    options { [google.api.http] { post: "/v1/books" body: "*" } }
+  }
+}
+options { go_package: "example.com/lro;lro" }
+syntax: "proto3"
+`
+
+// lroFiles returns descriptor.proto, operations.proto and lro.proto, CreateBook has operation_info
+// set through a dynamic extension type, so it is an unknown field once the request is unmarshaled.
+func lroFiles(t *testing.T) ([]*descriptor.FileDescriptorProto, protoreflect.ExtensionType) {
+	t.Helper()
+	files := []*descriptor.FileDescriptorProto{protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto)}
+	for _, f := range []string{operationsProto, lroProto} {
+		fd := &descriptor.FileDescriptorProto{}
+		if err := prototext.Unmarshal([]byte(f), fd); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fd)
+	}
+	xt, err := dynamicOperationInfoType(files)
+	if err != nil || xt == nil {
+		t.Fatalf("dynamicOperationInfoType = %v, %v", xt, err)
+	}
+	info := dynamicpb.NewMessage(xt.TypeDescriptor().Message())
+	info.Set(info.Descriptor().Fields().ByName("response_type"), protoreflect.ValueOfString("Book"))
+	info.Set(info.Descriptor().Fields().ByName("metadata_type"), protoreflect.ValueOfString("lro.v1.Book"))
+	opts := dynamicpb.NewMessage(xt.TypeDescriptor().ContainingMessage())
+	opts.Set(xt.TypeDescriptor(), protoreflect.ValueOfMessage(info))
+	b, err := proto.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meth := files[2].GetService()[0].GetMethod()[0]
+	if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(b, meth.GetOptions()); err != nil {
+		t.Fatal(err)
+	}
+	return files, xt
+}
+
+func TestOperationInfo(t *testing.T) {
+	files, xt := lroFiles(t)
+	meth := files[2].GetService()[0].GetMethod()[0]
+	defer func(old protoreflect.ExtensionType) { operationInfoType = old }(operationInfoType)
+
+	// operation_info is an unknown field of MethodOptions
+	operationInfoType = xt
+	if len(meth.GetOptions().ProtoReflect().GetUnknown()) == 0 {
+		t.Fatal("operation_info should be an unknown field")
+	}
+	res, meta, ok := operationInfo(meth)
+	if !ok || res != "Book" || meta != "lro.v1.Book" {
+		t.Errorf("unknown field: operationInfo = %q, %q, %v", res, meta, ok)
+	}
+
+	// operation_info is a known field, as when the extension is linked into the plugin
+	known := proto.Clone(meth).(*descriptor.MethodDescriptorProto)
+	known.Options = &descriptor.MethodOptions{}
+	info := dynamicpb.NewMessage(xt.TypeDescriptor().Message())
+	info.Set(info.Descriptor().Fields().ByName("response_type"), protoreflect.ValueOfString("Book"))
+	proto.SetExtension(known.Options, xt, info)
+	res, meta, ok = operationInfo(known)
+	if !ok || res != "Book" || meta != "" {
+		t.Errorf("known field: operationInfo = %q, %q, %v", res, meta, ok)
+	}
+
+	// no operation_info
+	none := proto.Clone(meth).(*descriptor.MethodDescriptorProto)
+	none.Options = &descriptor.MethodOptions{}
+	if _, _, ok := operationInfo(none); ok {
+		t.Error("operationInfo reports ok without operation_info")
+	}
+	operationInfoType = nil
+	if _, _, ok := operationInfo(meth); ok {
+		t.Error("operationInfo reports ok without the extension type")
+	}
+}
+
+func TestGenLRO(t *testing.T) {
+	files, _ := lroFiles(t)
+	code := genDescriptors(t, "", files...)["example.com/lro/lro.api.go"]
+	for _, want := range []string{
+		"CreateBookOperation(op *longrunningpb.Operation, opts ...Option) *BookCreateBookOperation",
+		`newOperation(buildOptions(c.opts, opts...), "/v1", op)`,
+		"Metadata() (*Book, error)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %s:\n%s", want, code)
+		}
+	}
+}
@@ -1,20 +1,44 @@
 package genapi
 
 import (
-	"errors"
 	"fmt"
+	"path"
 	"strings"
+	"time"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+const (
+	pathsImport         = "import"
+	pathsSourceRelative = "source_relative"
 )
 
 type options struct {
 	// 输出文件路径
 	out string
+	// 输出文件的路径模式，import 或 source_relative，同 protoc-gen-go
+	paths string
+	// 使用 paths=import 时从输出路径去掉的 go module 前缀
+	module string
+	// M<file>=<importpath> 指定的 proto 文件到 go import path 的映射
+	pkgOverrides map[string]string
+	// 覆盖内置模板的模板目录
+	templateDir string
+	// 非流式方法默认的超时时间
+	defaultTimeout time.Duration
+	// method_timeout=<Service>.<Method>:<duration> 指定的方法超时时间
+	methodTimeouts map[string]time.Duration
 }
 
 func parseOptions(param *string) (*options, error) {
-	opts := options{}
+	opts := options{
+		paths:          pathsImport,
+		pkgOverrides:   map[string]string{},
+		methodTimeouts: map[string]time.Duration{},
+	}
 	if param == nil {
-		return nil, errors.New("empty options parameter")
+		return &opts, nil
 	}
 	for _, s := range strings.Split(*param, ",") {
 		if s == "" {
@@ -29,10 +53,86 @@ func parseOptions(param *string) (*options, error) {
 			return nil, fmt.Errorf("invalid plugin option value, missing value in key=value: %s", s)
 		}
 
-		switch key {
-		case "out":
+		switch {
+		case key == "out":
 			opts.out = val
+		case key == "paths":
+			if val != pathsImport && val != pathsSourceRelative {
+				return nil, fmt.Errorf("invalid plugin option paths, must be import or source_relative: %s", s)
+			}
+			opts.paths = val
+		case key == "module":
+			opts.module = val
+		case key == "template_dir":
+			opts.templateDir = val
+		case key == "default_timeout":
+			d, err := time.ParseDuration(val)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid plugin option default_timeout, must be a duration like 30s: %s", s)
+			}
+			opts.defaultTimeout = d
+		case key == "method_timeout":
+			c := strings.LastIndexByte(val, ':')
+			if c <= 0 {
+				return nil, fmt.Errorf("invalid plugin option method_timeout, must be <Service>.<Method>:<duration>: %s", s)
+			}
+			d, err := time.ParseDuration(val[c+1:])
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid plugin option method_timeout, must be <Service>.<Method>:<duration>: %s", s)
+			}
+			opts.methodTimeouts[val[:c]] = d
+		case strings.HasPrefix(key, "M"):
+			opts.pkgOverrides[key[1:]] = val
 		}
 	}
 	return &opts, nil
 }
+
+// outputName returns the path of the file generated for proto file fd with the suffix,
+// following the paths and module options of protoc-gen-go.
+func (o *options) outputName(fd *descriptor.FileDescriptorProto, suffix string) (string, error) {
+	base := strings.TrimSuffix(fd.GetName(), ".proto")
+	name := base + suffix
+	if o.paths == pathsImport {
+		name = path.Join(goImportPath(fd), path.Base(base)+suffix)
+	}
+	if o.module != "" && o.paths == pathsImport {
+		prefix := strings.TrimSuffix(o.module, "/") + "/"
+		if !strings.HasPrefix(name, prefix) {
+			return "", fmt.Errorf("%s: generated file %q does not match prefix %q", fd.GetName(), name, o.module)
+		}
+		name = strings.TrimPrefix(name, prefix)
+	}
+	if len(o.out) > 0 {
+		name = path.Join(o.out, name)
+	}
+	return name, nil
+}
+
+// timeout returns the default timeout of a non-streaming rpc, method_timeout overrides default_timeout.
+func (o *options) timeout(serv *descriptor.ServiceDescriptorProto, meth *descriptor.MethodDescriptorProto) time.Duration {
+	if d, ok := o.methodTimeouts[serv.GetName()+"."+meth.GetName()]; ok {
+		return d
+	}
+	return o.defaultTimeout
+}
+
+// durationCode returns the go expression of d, such as 30 * time.Second.
+func durationCode(d time.Duration) string {
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+	for _, u := range units {
+		if d%u.d == 0 {
+			return fmt.Sprintf("%d * %s", d/u.d, u.name)
+		}
+	}
+	return fmt.Sprintf("%d * time.Nanosecond", int64(d))
+}
@@ -11,11 +11,37 @@ var optsCode = `// Generated by protoc-gen-go_api(github.com/dev-openapi/protoc-
 package {{ .GoPackage }}
 
 import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"encoding/json"
+	"encoding/xml"
 	"context"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 type Option func(*Options)
@@ -23,6 +49,24 @@ type Option func(*Options)
 type FnRequest func(context.Context, *http.Client,*http.Request) (*http.Response, error)
 type FnResponse func(context.Context, *http.Response, interface{}) error
 
+// CallInfo describes the rpc of a request.
+type CallInfo struct {
+	// Service is the proto service name, such as UserService
+	Service string
+	// Method is the rpc name, such as GetUser
+	Method string
+	// Route is the path template of the http binding, such as /v1/{name=users/*}
+	Route string
+	// Verb is the http method of the http binding
+	Verb string
+}
+
+// Invoker sends the request of a call.
+type Invoker func(ctx context.Context, info *CallInfo, req *http.Request) (*http.Response, error)
+
+// Interceptor intercepts the request of a call, it calls next to continue the chain.
+type Interceptor func(ctx context.Context, info *CallInfo, req *http.Request, next Invoker) (*http.Response, error)
+
 var (
 	ErrNil = errors.New("resp nil")
 	ErrNot200 = errors.New("resp not 200")
@@ -37,13 +81,51 @@ type Options struct {
 	addr string
 	// client
 	client *http.Client
+	// binding index of the http rule, 0 is the primary one
+	binding int
+	// protojson options of request bodies
+	marshalOptions protojson.MarshalOptions
+	// protojson options of response bodies
+	unmarshalOptions protojson.UnmarshalOptions
+	// polling delays of long-running operations
+	pollInitialDelay time.Duration
+	pollMaxDelay     time.Duration
+	// caps of pagination iterators, 0 means no limit
+	maxPages int
+	maxItems int
+	// timeout of each call, 0 uses the default timeout of the method
+	timeout time.Duration
+	// retry policy of all the methods
+	retry *RetryPolicy
+	// retry policies of single methods, keyed by Service.Method
+	methodRetry map[string]*RetryPolicy
+	// interceptors of the calls, the first one is the outermost
+	interceptors []Interceptor
+	// headers, query parameters and cookies added to the requests
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	// credentials of the requests
+	tokenSource TokenSource
+	apiKey      *apiKey
+	basicAuth   *basicAuth
+	// access token sent in the query, and the errcodes meaning it has expired
+	queryToken   *queryToken
+	tokenExpired func(errcode int) bool
+	// business envelope of the responses, set by the service from the goapi annotations
+	envelope *envelope
+	// signer of the requests and verifier of the responses
+	signer   Signer
+	verifier Verifier
 }
 
 func newOptions(opts ...Option) *Options {
 	opt := Options{
 		client: http.DefaultClient,
 		DoRequest: doRequest,
-		DoResponse: doResponse,
+		unmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		pollInitialDelay: {{ .PollInitialDelay }},
+		pollMaxDelay: {{ .PollMaxDelay }},
 	}
 	for _, o := range opts {
 		o(&opt)
@@ -51,31 +133,1701 @@ func newOptions(opts ...Option) *Options {
 	return &opt
 }
 
+// buildOptions applies the call options on a copy of the service options.
 func buildOptions(opt *Options, opts ...Option) *Options {
-	res := newOptions(opts...)
-	if len(res.addr) == 0 {
-		res.addr = opt.addr
+	res := *opt
+	for _, o := range opts {
+		o(&res)
+	}
+	if res.DoResponse == nil {
+		res.DoResponse = res.doResponse
 	}
-	return res
+	return &res
+}
+
+// disableDefaultDeadlines turns off the default timeouts of the methods when {{ .DisableDeadlinesVar }} is true.
+var disableDefaultDeadlines, _ = strconv.ParseBool(os.Getenv("{{ .DisableDeadlinesVar }}"))
+
+// withTimeout derives the context of a call from the timeout option or def, the default timeout of the method
+// generated from the plugin options, 0 if it has none. An earlier deadline of ctx is kept.
+func (o *Options) withTimeout(ctx context.Context, def time.Duration) (context.Context, context.CancelFunc) {
+	d := o.timeout
+	if d <= 0 && !disableDefaultDeadlines {
+		d = def
+	}
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
 }
 
 func doRequest(_ context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
 	return client.Do(req)
 }
 
-func doResponse(_ context.Context, resp *http.Response, a interface{}) error {
+// RetryPolicy controls how failed requests are retried, zero fields use the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts including the first one, default 3, 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, default 100ms
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, default 10s
+	MaxBackoff time.Duration
+	// Multiplier is the growth of the delay after each attempt, default 2
+	Multiplier float64
+	// RetryableCodes are the http status codes to retry, default 429, 502, 503 and 504
+	RetryableCodes []int
+	// RetryNonIdempotent also retries POST, PATCH and custom verbs,
+	// by default only GET, HEAD, OPTIONS, PUT and DELETE requests are retried
+	RetryNonIdempotent bool
+}
+
+var defaultRetryableCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts == 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the n-th retry, which is randomized in [d/2, d].
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	initial, max, mul := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	if mul < 1 {
+		mul = 2
+	}
+	d := float64(initial)
+	for i := 1; i < n && d < float64(max); i++ {
+		d *= mul
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	half := int64(d) / 2
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// retryable reports whether the result of an attempt should be retried.
+func (p *RetryPolicy) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if !p.RetryNonIdempotent {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		default:
+			return false
+		}
+	}
+	if err != nil {
+		return isConnError(err)
+	}
 	if resp == nil {
-		return ErrNil
+		return false
 	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return ErrNot200
+	codes := p.RetryableCodes
+	if codes == nil {
+		codes = defaultRetryableCodes
+	}
+	for _, c := range codes {
+		if resp.StatusCode == c {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnError reports whether err is a network error of sending the request,
+// errors of the context are not.
+func isConnError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryAfter parses the Retry-After header in seconds or http date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if len(v) == 0 {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (o *Options) retryPolicy(method string) *RetryPolicy {
+	if p, ok := o.methodRetry[method]; ok {
+		return p
+	}
+	return o.retry
+}
+
+// setRequest merges the header, query and cookie options into the request. They replace the
+// headers and query parameters of the same key generated from the message, and since the call options
+// are applied after the service options, a call option replaces the service option of the same key.
+func (o *Options) setRequest(req *http.Request) {
+	for k, vs := range o.header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if len(o.query) > 0 {
+		q := req.URL.Query()
+		for k, vs := range o.query {
+			q[k] = append([]string(nil), vs...)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	for _, c := range o.cookies {
+		req.AddCookie(c)
+	}
+}
+
+// Signer signs a finished request, body is the buffered request body, nil when there is none.
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// SignerFunc adapts a function to a Signer.
+type SignerFunc func(req *http.Request, body []byte) error
+
+func (f SignerFunc) Sign(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// Verifier verifies the signature of a successful response, body is the buffered response body.
+type Verifier interface {
+	Verify(resp *http.Response, body []byte) error
+}
+
+// VerifierFunc adapts a function to a Verifier.
+type VerifierFunc func(resp *http.Response, body []byte) error
+
+func (f VerifierFunc) Verify(resp *http.Response, body []byte) error {
+	return f(resp, body)
+}
+
+// sign signs the request with the signer of the options, the body is read from req.GetBody.
+func (o *Options) sign(req *http.Request) error {
+	if o.signer == nil {
+		return nil
+	}
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return errors.New("sign request: the request body can not be buffered")
+		}
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return o.signer.Sign(req, body)
+}
+
+// canonicalSigner signs the message of method, url, timestamp, nonce and body, each followed by \n,
+// as WeChat Pay v3 does, and sets the Authorization header as
+// {scheme} {params},nonce_str="{nonce}",signature="{signature}",timestamp="{timestamp}" sorted by name.
+type canonicalSigner struct {
+	scheme string
+	params map[string]string
+	sign   func(msg []byte) ([]byte, error)
+}
+
+func (s *canonicalSigner) Sign(req *http.Request, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	uri := req.URL.EscapedPath()
+	if len(req.URL.RawQuery) > 0 {
+		uri += "?" + req.URL.RawQuery
+	}
+	msg := req.Method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	sig, err := s.sign([]byte(msg))
+	if err != nil {
+		return fmt.Errorf("sign request: %w", err)
+	}
+	params := map[string]string{
+		"nonce_str": nonce,
+		"timestamp": timestamp,
+		"signature": base64.StdEncoding.EncodeToString(sig),
+	}
+	for k, v := range s.params {
+		params[k] = v
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, params[k]))
+	}
+	req.Header.Set("Authorization", s.scheme+" "+strings.Join(pairs, ","))
+	return nil
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(b)), nil
+}
+
+// NewHMACSHA256Signer returns a Signer signing the canonical request with HMAC-SHA256 of the key,
+// params such as the key id are added to the Authorization header of the scheme.
+func NewHMACSHA256Signer(scheme string, key []byte, params map[string]string) Signer {
+	return &canonicalSigner{scheme: scheme, params: params, sign: func(msg []byte) ([]byte, error) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(msg)
+		return mac.Sum(nil), nil
+	}}
+}
+
+// NewRSASHA256Signer returns a Signer signing the canonical request with RSA-SHA256 (PKCS #1 v1.5) of the key,
+// such as WECHATPAY2-SHA256-RSA2048 with the params mchid and serial_no.
+func NewRSASHA256Signer(scheme string, key *rsa.PrivateKey, params map[string]string) Signer {
+	return &canonicalSigner{scheme: scheme, params: params, sign: func(msg []byte) ([]byte, error) {
+		sum := sha256.Sum256(msg)
+		return rsa.SignPKCS1v15(crand.Reader, key, crypto.SHA256, sum[:])
+	}}
+}
+
+// defaultVerifyWindow is how far the timestamp of a signed response may be from now.
+const defaultVerifyWindow = 5 * time.Minute
+
+// headerVerifier verifies the signature of the message of timestamp, nonce and body, each followed by \n,
+// which are read from the headers {prefix}Timestamp, {prefix}Nonce and {prefix}Signature in base64.
+// The timestamp in unix seconds must be within the window of now, so old responses can not be replayed.
+type headerVerifier struct {
+	prefix string
+	window time.Duration
+	verify func(msg, sig []byte) error
+}
+
+func (v *headerVerifier) Verify(resp *http.Response, body []byte) error {
+	timestamp := resp.Header.Get(v.prefix + "Timestamp")
+	if len(timestamp) == 0 {
+		return errors.New("missing response timestamp")
+	}
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid response timestamp %q", timestamp)
+	}
+	window := v.window
+	if window <= 0 {
+		window = defaultVerifyWindow
+	}
+	if d := time.Since(time.Unix(secs, 0)); d > window || d < -window {
+		return fmt.Errorf("response timestamp %s is not within %v of now", timestamp, window)
+	}
+	nonce := resp.Header.Get(v.prefix + "Nonce")
+	sig, err := base64.StdEncoding.DecodeString(resp.Header.Get(v.prefix + "Signature"))
+	if err != nil || len(sig) == 0 {
+		return errors.New("invalid response signature")
+	}
+	msg := timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	return v.verify([]byte(msg), sig)
+}
+
+// NewHMACSHA256Verifier returns a Verifier checking HMAC-SHA256 signatures of the key in the headers of the prefix,
+// the timestamp must be within window of now, 0 means 5 minutes.
+func NewHMACSHA256Verifier(key []byte, headerPrefix string, window time.Duration) Verifier {
+	return &headerVerifier{prefix: headerPrefix, window: window, verify: func(msg, sig []byte) error {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(msg)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errors.New("response signature mismatch")
+		}
+		return nil
+	}}
+}
+
+// NewRSASHA256Verifier returns a Verifier checking RSA-SHA256 signatures of the key in the headers of the prefix,
+// such as Wechatpay- of WeChat Pay v3, the timestamp must be within window of now, 0 means 5 minutes.
+func NewRSASHA256Verifier(key *rsa.PublicKey, headerPrefix string, window time.Duration) Verifier {
+	return &headerVerifier{prefix: headerPrefix, window: window, verify: func(msg, sig []byte) error {
+		sum := sha256.Sum256(msg)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig)
+	}}
+}
+
+// Token is an access token returned by a TokenSource.
+type Token struct {
+	// AccessToken is sent in the Authorization header
+	AccessToken string
+	// TokenType is the scheme of the Authorization header, default Bearer
+	TokenType string
+	// Expiry is the expiration time of the token, zero means it never expires
+	Expiry time.Time
+}
+
+// TokenSource returns access tokens, like oauth2.TokenSource.
+type TokenSource interface {
+	Token() (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func() (*Token, error)
+
+func (f TokenSourceFunc) Token() (*Token, error) {
+	return f()
+}
+
+// tokenExpiryDelta is how long before the expiry a cached token is refreshed.
+const tokenExpiryDelta = 10 * time.Second
+
+// cachedTokenSource reuses the token until it is about to expire.
+type cachedTokenSource struct {
+	mu  sync.Mutex
+	src TokenSource
+	tok *Token
+}
+
+func (s *cachedTokenSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok != nil && (s.tok.Expiry.IsZero() || time.Until(s.tok.Expiry) > tokenExpiryDelta) {
+		return s.tok, nil
+	}
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.tok = tok
+	return tok, nil
+}
+
+// APIKeyLocation is where an api key is sent.
+type APIKeyLocation string
+
+const (
+	APIKeyInHeader APIKeyLocation = "header"
+	APIKeyInQuery  APIKeyLocation = "query"
+)
+
+type apiKey struct {
+	location    APIKeyLocation
+	name, value string
+}
+
+type basicAuth struct {
+	username, password string
+}
+
+// authorize sets the credentials on the request, the token of the token source
+// takes precedence over basic auth in the Authorization header.
+func (o *Options) authorize(req *http.Request) error {
+	if o.basicAuth != nil {
+		req.SetBasicAuth(o.basicAuth.username, o.basicAuth.password)
+	}
+	if o.tokenSource != nil {
+		tok, err := o.tokenSource.Token()
+		if err != nil {
+			return fmt.Errorf("get token: %w", err)
+		}
+		typ := tok.TokenType
+		if len(typ) == 0 {
+			typ = "Bearer"
+		}
+		req.Header.Set("Authorization", typ+" "+tok.AccessToken)
+	}
+	if o.apiKey != nil {
+		switch o.apiKey.location {
+		case APIKeyInQuery:
+			q := req.URL.Query()
+			q.Set(o.apiKey.name, o.apiKey.value)
+			req.URL.RawQuery = q.Encode()
+		default:
+			req.Header.Set(o.apiKey.name, o.apiKey.value)
+		}
+	}
+	return nil
+}
+
+// TokenProvider fetches access tokens sent in the query from the token endpoint,
+// such as access_token of WeChat APIs.
+type TokenProvider interface {
+	// FetchToken returns a new token and how long it is valid, 0 means it is valid until reported expired.
+	FetchToken(ctx context.Context) (token string, expiresIn time.Duration, err error)
+}
+
+// TokenProviderFunc adapts a function to a TokenProvider.
+type TokenProviderFunc func(ctx context.Context) (string, time.Duration, error)
+
+func (f TokenProviderFunc) FetchToken(ctx context.Context) (string, time.Duration, error) {
+	return f(ctx)
+}
+
+// queryToken caches the token of a TokenProvider.
+type queryToken struct {
+	name     string
+	provider TokenProvider
+	mu       sync.Mutex
+	token    string
+	expiry   time.Time
+}
+
+func (t *queryToken) get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.token) > 0 && (t.expiry.IsZero() || time.Until(t.expiry) > tokenExpiryDelta) {
+		return t.token, nil
+	}
+	tok, expiresIn, err := t.provider.FetchToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("fetch token: %w", err)
+	}
+	t.token, t.expiry = tok, time.Time{}
+	if expiresIn > 0 {
+		t.expiry = time.Now().Add(expiresIn)
+	}
+	return tok, nil
+}
+
+// invalidate drops the cached token if it is still old, so concurrent calls refresh it once.
+func (t *queryToken) invalidate(old string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == old {
+		t.token = ""
+	}
+}
+
+// defaultTokenExpired matches the errcodes of invalid or expired access_token of WeChat APIs.
+func defaultTokenExpired(errcode int) bool {
+	switch errcode {
+	case 40001, 40014, 42001:
+		return true
+	}
+	return false
+}
+
+// addQueryToken adds the token of WithQueryToken to the query parameters.
+func (o *Options) addQueryToken(ctx context.Context, params url.Values) error {
+	if o.queryToken == nil {
+		return nil
+	}
+	tok, err := o.queryToken.get(ctx)
+	if err != nil {
+		return err
+	}
+	params.Set(o.queryToken.name, tok)
+	return nil
+}
+
+// peekErrcode reads the errcode of a json response, the body is kept for DoResponse.
+func peekErrcode(resp *http.Response) (int, error) {
+	bs, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(bs))
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(bs), []byte("{")) {
+		return 0, nil
+	}
+	var v struct {
+		Errcode int ` + "`json:\"errcode\"`" + `
+	}
+	_ = json.Unmarshal(bs, &v)
+	return v.Errcode, nil
+}
+
+// do sends the request through the interceptors, then retries it by the retry policy of the method.
+func (o *Options) do(ctx context.Context, req *http.Request, info *CallInfo) (*http.Response, error) {
+	return o.intercept(ctx, info, req, o.refreshTokenRequest)
+}
+
+// refreshTokenRequest sends the request, and when the response reports that the query token
+// has expired, it refreshes the token and sends the request once again.
+func (o *Options) refreshTokenRequest(ctx context.Context, info *CallInfo, req *http.Request) (*http.Response, error) {
+	resp, err := o.retryRequest(ctx, info, req)
+	qt := o.queryToken
+	if err != nil || resp == nil || qt == nil {
+		return resp, err
+	}
+	old := req.URL.Query().Get(qt.name)
+	if len(old) == 0 {
+		return resp, nil
+	}
+	code, err := peekErrcode(resp)
+	if err != nil {
+		return nil, err
+	}
+	expired := o.tokenExpired
+	if expired == nil {
+		expired = defaultTokenExpired
+	}
+	if code == 0 || !expired(code) {
+		return resp, nil
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+	qt.invalidate(old)
+	tok, err := qt.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	if req.GetBody != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	q := req.URL.Query()
+	q.Set(qt.name, tok)
+	req.URL.RawQuery = q.Encode()
+	return o.retryRequest(ctx, info, req)
+}
+
+// intercept runs the interceptors in order around invoker.
+func (o *Options) intercept(ctx context.Context, info *CallInfo, req *http.Request, invoker Invoker) (*http.Response, error) {
+	next := invoker
+	for i := len(o.interceptors) - 1; i >= 0; i-- {
+		ic, n := o.interceptors[i], next
+		next = func(ctx context.Context, info *CallInfo, req *http.Request) (*http.Response, error) {
+			return ic(ctx, info, req, n)
+		}
+	}
+	return next(ctx, info, req)
+}
+
+// retryRequest sends the request with DoRequest and retries it by the retry policy of the method,
+// the body is rebuilt from req.GetBody for each attempt.
+func (o *Options) retryRequest(ctx context.Context, info *CallInfo, req *http.Request) (*http.Response, error) {
+	policy := o.retryPolicy(info.Service + "." + info.Method)
+	for attempt := 1; ; attempt++ {
+		// Each attempt is signed again for a fresh timestamp and nonce.
+		if err := o.sign(req); err != nil {
+			return nil, err
+		}
+		resp, err := o.DoRequest(ctx, o.client, req)
+		if policy == nil || attempt >= policy.maxAttempts() || ctx.Err() != nil || !policy.retryable(req, resp, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+		delay, ok := retryAfter(resp)
+		if !ok {
+			delay = policy.backoff(attempt)
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		req = req.Clone(req.Context())
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// doResponse is the default DoResponse, it decodes the body with the unmarshal options.
+func (o *Options) doResponse(_ context.Context, resp *http.Response, a interface{}) error {
+	if resp == nil {
+		return ErrNil
 	}
 	defer func(){ _ = resp.Body.Close()}()
 	bs, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(bs, a)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp, bs)
+	}
+	if o.verifier != nil {
+		if err := o.verifier.Verify(resp, bs); err != nil {
+			return fmt.Errorf("verify response: %w", err)
+		}
+	}
+	if m, ok := a.(proto.Message); ok && setHttpBody(m, resp.Header.Get("Content-Type"), bs) {
+		return nil
+	}
+	if isXML(resp.Header.Get("Content-Type")) {
+		return unmarshalXML(bs, a)
+	}
+	if o.envelope != nil {
+		if bs, err = o.envelope.unwrap(bs); err != nil {
+			return err
+		}
+	}
+	return o.unmarshalJSON(bs, a)
+}
+
+// envelope is the business wrapper of responses, such as {"errcode":0,"errmsg":"ok","data":{}}.
+type envelope struct {
+	codeField    string
+	messageField string
+	successValue string
+	dataField    string
+}
+
+// BusinessError is returned when the business code of the response envelope is not the success value.
+type BusinessError struct {
+	// rpc method, such as UserService.GetUser
+	Method string
+	// business code, the text of a json string or the literal of a json number
+	Code    string
+	Message string
+	// response body
+	Body []byte
+}
+
+func (e *BusinessError) Error() string {
+	b := strings.Builder{}
+	if e.Method != "" {
+		b.WriteString(e.Method + ": ")
+	}
+	b.WriteString("business error " + e.Code)
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+// unwrap checks the business code of the body, and returns the data field to decode,
+// or the whole body when there is no data field. Bodies not of a json object are returned as is.
+func (e *envelope) unwrap(bs []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &fields); err != nil {
+		return bs, nil
+	}
+	if raw, ok := fields[e.codeField]; ok && string(raw) != "null" {
+		if code := jsonText(raw); code != e.successValue {
+			return nil, &BusinessError{Code: code, Message: jsonText(fields[e.messageField]), Body: bs}
+		}
+	}
+	if len(e.dataField) == 0 {
+		return bs, nil
+	}
+	data, ok := fields[e.dataField]
+	if !ok || string(data) == "null" {
+		return []byte("{}"), nil
+	}
+	return data, nil
+}
+
+// jsonText returns the text of a json string, or the literal of other json values.
+func jsonText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(raw))
+}
+
+// setHttpBody fills content_type and data when m is a google.api.HttpBody.
+func setHttpBody(m proto.Message, contentType string, data []byte) bool {
+	r := m.ProtoReflect()
+	if r.Descriptor().FullName() != "google.api.HttpBody" {
+		return false
+	}
+	fields := r.Descriptor().Fields()
+	r.Set(fields.ByName("content_type"), protoreflect.ValueOfString(contentType))
+	r.Set(fields.ByName("data"), protoreflect.ValueOfBytes(data))
+	return true
+}
+
+// marshalJSON encodes proto messages with protojson and the others with encoding/json.
+func (o *Options) marshalJSON(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return o.marshalOptions.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+// ResponseBody is passed to DoResponse when the http rule has response_body,
+// the http body is the value of the Field in the response Message.
+type ResponseBody struct {
+	// proto name of the top-level field
+	Field string
+	// response message
+	Message proto.Message
+}
+
+// unmarshalJSON decodes proto messages with protojson and the others with encoding/json.
+func (o *Options) unmarshalJSON(bs []byte, v interface{}) error {
+	if len(bs) == 0 {
+		return nil
+	}
+	if rb, ok := v.(*ResponseBody); ok {
+		wrapped, err := json.Marshal(map[string]json.RawMessage{rb.Field: bs})
+		if err != nil {
+			return err
+		}
+		return o.unmarshalOptions.Unmarshal(wrapped, rb.Message)
+	}
+	if m, ok := v.(proto.Message); ok {
+		return o.unmarshalOptions.Unmarshal(bs, m)
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// isXML reports whether the content type is xml, such as application/xml, text/xml or application/atom+xml.
+func isXML(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return ct == "application/xml" || ct == "text/xml" || strings.HasSuffix(ct, "+xml")
+}
+
+// marshalXML encodes the message as the root element, fields are child elements named by their proto names,
+// repeated fields repeat the element, map entries are elements with key and value children,
+// well known types are the text of their proto3 JSON mapping.
+func marshalXML(root string, m proto.Message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := xml.NewEncoder(buf)
+	if err := encodeXMLMessage(enc, root, m.ProtoReflect()); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeXMLMessage(enc *xml.Encoder, name string, m protoreflect.Message) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if isWellKnownXML(m.Descriptor()) {
+		text, err := queryJSON(m.Interface())
+		if err != nil {
+			return err
+		}
+		return enc.EncodeElement(text, start)
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		name, v := string(fd.Name()), m.Get(fd)
+		switch {
+		case fd.IsList():
+			l := v.List()
+			for j := 0; j < l.Len(); j++ {
+				if err := encodeXMLValue(enc, name, fd, l.Get(j)); err != nil {
+					return err
+				}
+			}
+		case fd.IsMap():
+			if err := encodeXMLMap(enc, name, fd, v.Map()); err != nil {
+				return err
+			}
+		default:
+			if err := encodeXMLValue(enc, name, fd, v); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// encodeXMLMap encodes the entries in key order, so that the body is stable for signing.
+func encodeXMLMap(enc *xml.Encoder, name string, fd protoreflect.FieldDescriptor, mp protoreflect.Map) error {
+	keys := make([]protoreflect.MapKey, 0, mp.Len())
+	mp.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return xmlText(fd.MapKey(), keys[i].Value()) < xmlText(fd.MapKey(), keys[j].Value())
+	})
+	for _, k := range keys {
+		start := xml.StartElement{Name: xml.Name{Local: name}}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := encodeXMLValue(enc, "key", fd.MapKey(), k.Value()); err != nil {
+			return err
+		}
+		if err := encodeXMLValue(enc, "value", fd.MapValue(), mp.Get(k)); err != nil {
+			return err
+		}
+		if err := enc.EncodeToken(start.End()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeXMLValue(enc *xml.Encoder, name string, fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	if fd.Message() != nil {
+		return encodeXMLMessage(enc, name, v.Message())
+	}
+	return enc.EncodeElement(xmlText(fd, v), xml.StartElement{Name: xml.Name{Local: name}})
+}
+
+// xmlText is the element text of a scalar value, enums are their names and bytes are base64 encoded.
+func xmlText(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(v.Bool())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return strconv.FormatInt(v.Int(), 10)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.FormatUint(v.Uint(), 10)
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes())
+	}
+	return v.String()
+}
+
+// unmarshalXML decodes the xml body, child elements of the root are matched to fields by their proto or json names,
+// unknown elements are skipped. With ResponseBody the root element is the value of the field.
+func unmarshalXML(bs []byte, v interface{}) error {
+	if len(bytes.TrimSpace(bs)) == 0 {
+		return nil
+	}
+	var m proto.Message
+	var field protoreflect.FieldDescriptor
+	switch t := v.(type) {
+	case *ResponseBody:
+		m = t.Message
+		field = m.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(t.Field))
+		if field == nil {
+			return fmt.Errorf("response_body %s is not a field of %s", t.Field, m.ProtoReflect().Descriptor().FullName())
+		}
+	case proto.Message:
+		m = t
+	default:
+		return xml.Unmarshal(bs, v)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(bs))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(xml.StartElement); !ok {
+			continue
+		}
+		if field != nil {
+			return decodeXMLField(dec, m.ProtoReflect(), field)
+		}
+		return decodeXMLMessage(dec, m.ProtoReflect())
+	}
+}
+
+// decodeXMLMessage decodes the children of the current element into m, up to the end of the element.
+func decodeXMLMessage(dec *xml.Decoder, m protoreflect.Message) error {
+	if isWellKnownXML(m.Descriptor()) {
+		text, err := xmlElementText(dec)
+		if err != nil {
+			return err
+		}
+		// the text of string values such as Timestamp is not quoted
+		if protojson.Unmarshal([]byte(text), m.Interface()) == nil {
+			return nil
+		}
+		return protojson.Unmarshal([]byte(strconv.Quote(text)), m.Interface())
+	}
+	fields := m.Descriptor().Fields()
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			fd := fields.ByName(protoreflect.Name(t.Name.Local))
+			if fd == nil {
+				fd = fields.ByJSONName(t.Name.Local)
+			}
+			if fd == nil {
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := decodeXMLField(dec, m, fd); err != nil {
+				return fmt.Errorf("%s: %w", fd.FullName(), err)
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodeXMLField decodes the current element as a value of fd, repeated elements are appended.
+func decodeXMLField(dec *xml.Decoder, m protoreflect.Message, fd protoreflect.FieldDescriptor) error {
+	switch {
+	case fd.IsList():
+		l := m.Mutable(fd).List()
+		v, err := decodeXMLValue(dec, fd, l.NewElement)
+		if err != nil {
+			return err
+		}
+		l.Append(v)
+	case fd.IsMap():
+		return decodeXMLEntry(dec, fd, m.Mutable(fd).Map())
+	default:
+		v, err := decodeXMLValue(dec, fd, func() protoreflect.Value { return m.NewField(fd) })
+		if err != nil {
+			return err
+		}
+		m.Set(fd, v)
+	}
+	return nil
+}
+
+func decodeXMLEntry(dec *xml.Decoder, fd protoreflect.FieldDescriptor, mp protoreflect.Map) error {
+	key := fd.MapKey().Default().MapKey()
+	var val protoreflect.Value
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "key":
+				k, err := decodeXMLValue(dec, fd.MapKey(), nil)
+				if err != nil {
+					return err
+				}
+				key = k.MapKey()
+			case "value":
+				if val, err = decodeXMLValue(dec, fd.MapValue(), mp.NewValue); err != nil {
+					return err
+				}
+			default:
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			if !val.IsValid() {
+				if fd.MapValue().Message() != nil {
+					val = mp.NewValue()
+				} else {
+					val = fd.MapValue().Default()
+				}
+			}
+			mp.Set(key, val)
+			return nil
+		}
+	}
+}
+
+// decodeXMLValue decodes a single value of fd from the current element, newValue returns the message to fill.
+func decodeXMLValue(dec *xml.Decoder, fd protoreflect.FieldDescriptor, newValue func() protoreflect.Value) (protoreflect.Value, error) {
+	if fd.Message() != nil {
+		v := newValue()
+		return v, decodeXMLMessage(dec, v.Message())
+	}
+	text, err := xmlElementText(dec)
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	if fd.Kind() == protoreflect.StringKind {
+		return protoreflect.ValueOfString(text), nil
+	}
+	text = strings.TrimSpace(text)
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(text)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(text)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(text, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(text, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(text, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(text, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(text, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(text, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(text, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(text)
+		return protoreflect.ValueOfBytes(b), err
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
+
+// xmlElementText reads the character data up to the end of the current element, CDATA included.
+func xmlElementText(dec *xml.Decoder) (string, error) {
+	b := strings.Builder{}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.StartElement:
+			if err := dec.Skip(); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			return b.String(), nil
+		}
+	}
+}
+
+// isWellKnownXML reports whether the message is a well known type encoded as the text of its JSON mapping.
+func isWellKnownXML(md protoreflect.MessageDescriptor) bool {
+	return md.FullName().Parent() == "google.protobuf"
+}
+
+// queryJSON encodes well known types in query parameters with their proto3 JSON mapping,
+// json strings such as Timestamp and FieldMask are unquoted.
+func queryJSON(m proto.Message) (string, error) {
+	bs, err := protojson.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if json.Unmarshal(bs, &s) == nil {
+		return s, nil
+	}
+	return string(bs), nil
+}
+
+// APIError is returned by the default DoResponse when the http status is not 2xx,
+// errors.Is(err, ErrNot200) reports true for it.
+type APIError struct {
+	// rpc method, such as UserService.GetUser
+	Method string
+	// request url
+	URL string
+	// http status code, such as 404
+	StatusCode int
+	// http status, such as "404 Not Found"
+	Status string
+	// response header
+	Header http.Header
+	// raw response body
+	Body []byte
+	// Code, Message and Details are decoded from google.rpc.Status
+	// or grpc-gateway style error bodies when present.
+	Code    int
+	Message string
+	Details []json.RawMessage
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		e.URL = resp.Request.URL.String()
+	}
+	e.decodeStatus(body)
+	return e
+}
+
+// errorStatus is google.rpc.Status, the error field is the nested status of
+// google apis, or the error message of grpc-gateway v1.
+type errorStatus struct {
+	Code    int               ` + "`json:\"code\"`" + `
+	Message string            ` + "`json:\"message\"`" + `
+	Details []json.RawMessage ` + "`json:\"details\"`" + `
+	Error   json.RawMessage   ` + "`json:\"error\"`" + `
+}
+
+func (e *APIError) decodeStatus(body []byte) {
+	var st errorStatus
+	if err := json.Unmarshal(body, &st); err != nil {
+		return
+	}
+	var msg string
+	if len(st.Error) > 0 && json.Unmarshal(st.Error, &msg) != nil {
+		var nested errorStatus
+		if json.Unmarshal(st.Error, &nested) == nil {
+			st = nested
+		}
+	}
+	if st.Message == "" {
+		st.Message = msg
+	}
+	e.Code, e.Message, e.Details = st.Code, st.Message, st.Details
+}
+
+func (e *APIError) Error() string {
+	b := strings.Builder{}
+	if e.Method != "" {
+		b.WriteString(e.Method + ": ")
+	}
+	if e.URL != "" {
+		b.WriteString(e.URL + ": ")
+	}
+	b.WriteString(e.Status)
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+// Is makes errors.Is(err, ErrNot200) work for the APIError.
+func (e *APIError) Is(target error) bool {
+	return target == ErrNot200
+}
+
+// setErrorMethod fills the rpc method of the APIError or BusinessError returned by DoResponse.
+func setErrorMethod(err error, method string) error {
+	var e *APIError
+	if errors.As(err, &e) && e.Method == "" {
+		e.Method = method
+	}
+	var be *BusinessError
+	if errors.As(err, &be) && be.Method == "" {
+		be.Method = method
+	}
+	return err
+}
+
+// checkPathParam checks the path parameter v against the path template pattern,
+// * matches one segment and ** matches the rest segments.
+func checkPathParam(name, v, pattern string) error {
+	if v == "" {
+		return fmt.Errorf("path parameter %q is empty", name)
+	}
+	if pattern == "" {
+		return nil
+	}
+	vs, ps := strings.Split(v, "/"), strings.Split(pattern, "/")
+	for i, p := range ps {
+		if p == "**" {
+			for _, seg := range vs[i:] {
+				if seg == "" {
+					return fmt.Errorf("path parameter %q value %q does not match %q", name, v, pattern)
+				}
+			}
+			return nil
+		}
+		if i >= len(vs) || vs[i] == "" || (p != "*" && p != vs[i]) {
+			return fmt.Errorf("path parameter %q value %q does not match %q", name, v, pattern)
+		}
+	}
+	if len(vs) != len(ps) {
+		return fmt.Errorf("path parameter %q value %q does not match %q", name, v, pattern)
+	}
+	return nil
+}
+
+// escapePath percent-encodes all characters except [-_.~0-9a-zA-Z],
+// multi segment path parameters keep their slashes.
+func escapePath(s string, multi bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (multi && c == '/') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// serverStream reads the messages of a server streaming rpc from newline-delimited JSON,
+// grpc-gateway {"result":...}/{"error":...} envelopes or text/event-stream frames.
+type serverStream struct {
+	ctx    context.Context
+	opt    *Options
+	method string
+	resp   *http.Response
+	reader *bufio.Reader
+	sse    bool
+	done   chan struct{}
+	once   sync.Once
+	err    error
+	// recvErr ended the stream, it is returned by the later calls of recv
+	recvErr error
+}
+
+func newServerStream(ctx context.Context, opt *Options, req *http.Request, info *CallInfo) (*serverStream, error) {
+	method := info.Service + "." + info.Method
+	// The body of a stream is not buffered to check the expiry of the query token.
+	resp, err := opt.intercept(ctx, info, req, opt.retryRequest)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, ErrNil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer func(){ _ = resp.Body.Close()}()
+		bs, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, setErrorMethod(newAPIError(resp, bs), method)
+	}
+	s := &serverStream{
+		ctx:    ctx,
+		opt:    opt,
+		method: method,
+		resp:   resp,
+		reader: bufio.NewReader(resp.Body),
+		sse:    strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"),
+		done:   make(chan struct{}),
+	}
+	// Closing the body unblocks the reading when the context is done.
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = resp.Body.Close()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// Close closes the response body of the stream.
+func (s *serverStream) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.err = s.resp.Body.Close()
+	})
+	return s.err
+}
+
+func (s *serverStream) recv(m interface{}) error {
+	if s.recvErr != nil {
+		return s.recvErr
+	}
+	for {
+		event, data, err := s.next()
+		if err != nil {
+			if ctxErr := s.ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			return s.fail(err)
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		if event == "error" {
+			return s.fail(s.error(data))
+		}
+		var env map[string]json.RawMessage
+		if json.Unmarshal(data, &env) == nil && isStreamEnvelope(env) {
+			if e, ok := env["error"]; ok && string(e) != "null" {
+				return s.fail(s.error(data))
+			}
+			data = env["result"]
+		}
+		return s.opt.unmarshalJSON(data, m)
+	}
+}
+
+// fail ends the stream with err, the body is closed without reading the rest of the stream.
+func (s *serverStream) fail(err error) error {
+	s.recvErr = err
+	_ = s.Close()
+	return err
+}
+
+// next returns the next line of newline-delimited JSON, or the event name and data of the next sse frame.
+func (s *serverStream) next() (string, []byte, error) {
+	if !s.sse {
+		line, err := s.reader.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 {
+			return "", line, nil
+		}
+		return "", line, err
+	}
+	var event string
+	var data [][]byte
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil {
+			// An incomplete frame at the end of the stream is discarded.
+			return "", nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if len(data) > 0 {
+				return event, bytes.Join(data, []byte("\n")), nil
+			}
+			event = ""
+			continue
+		}
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], bytes.TrimPrefix(line[i+1:], []byte(" "))
+		}
+		switch string(field) {
+		case "event":
+			event = string(value)
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
+
+func (s *serverStream) error(data []byte) error {
+	e := newAPIError(s.resp, data)
+	e.Method = s.method
+	return e
+}
+
+// clientStream writes the messages of a client streaming rpc as newline-delimited JSON
+// over a chunked request body without buffering them.
+type clientStream struct {
+	ctx    context.Context
+	opt    *Options
+	method string
+	writer *io.PipeWriter
+	done   chan struct{}
+	resp   *http.Response
+	err    error
+}
+
+func newClientStream(ctx context.Context, opt *Options, req *http.Request, pr *io.PipeReader, pw *io.PipeWriter, info *CallInfo) *clientStream {
+	s := &clientStream{
+		ctx:    ctx,
+		opt:    opt,
+		method: info.Service + "." + info.Method,
+		writer: pw,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		// The pipe body can not be rewound, so the request is never retried or signed.
+		s.resp, s.err = opt.intercept(ctx, info, req, func(ctx context.Context, _ *CallInfo, req *http.Request) (*http.Response, error) {
+			if opt.signer != nil {
+				return nil, fmt.Errorf("%s: client streaming requests can not be signed", s.method)
+			}
+			return opt.DoRequest(ctx, opt.client, req)
+		})
+		// Sending fails once the request has finished.
+		_ = pr.Close()
+	}()
+	return s
+}
+
+func (s *clientStream) send(m interface{}) error {
+	bs, err := s.opt.marshalJSON(m)
+	if err != nil {
+		return err
+	}
+	if _, err := s.writer.Write(append(bs, '\n')); err != nil {
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return io.EOF
+	}
+	return nil
+}
+
+func (s *clientStream) closeAndRecv(res interface{}) error {
+	_ = s.writer.Close()
+	<-s.done
+	if s.err != nil {
+		return s.err
+	}
+	return setErrorMethod(s.opt.DoResponse(s.ctx, s.resp, res), s.method)
+}
+
+// ErrIteratorDone is returned by iterators when there are no more items or pages.
+var ErrIteratorDone = errors.New("no more items in iterator")
+
+// pager keeps the state of a pagination iterator.
+type pager struct {
+	token    string
+	done     bool
+	err      error
+	pages    int
+	items    int
+	maxPages int
+	maxItems int
+}
+
+func newPager(opts *Options, token string) *pager {
+	return &pager{token: token, maxPages: opts.maxPages, maxItems: opts.maxItems}
+}
+
+// PageToken returns the token of the next page, which can resume the iteration later,
+// it is empty when the last page has been fetched.
+func (p *pager) PageToken() string {
+	return p.token
+}
+
+// check returns the error to stop fetching the next page.
+func (p *pager) check() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.done || (p.maxPages > 0 && p.pages >= p.maxPages) || (p.maxItems > 0 && p.items >= p.maxItems) {
+		return ErrIteratorDone
+	}
+	return nil
+}
+
+// update records a fetched page with n items and returns how many of them are within maxItems,
+// the error is kept and returned by later calls.
+func (p *pager) update(token string, n int, err error) int {
+	if err != nil {
+		p.err = err
+		return 0
+	}
+	p.pages++
+	p.token = token
+	p.done = len(token) == 0
+	if p.maxItems > 0 && p.items+n > p.maxItems {
+		n = p.maxItems - p.items
+	}
+	p.items += n
+	return n
+}
+
+// OperationError is the error of a failed long-running operation.
+type OperationError struct {
+	// operation name
+	Name string
+	// google.rpc.Code of the error
+	Code int32
+	Message string
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %s failed: code %d: %s", e.Name, e.Code, e.Message)
+}
+
+// pollMultiplier is the growth of the polling delay of long-running operations.
+const pollMultiplier = 1.5
+
+// operation polls a google.longrunning.Operation through the Operations REST endpoint,
+// GET {addr}{prefix}/{name}.
+type operation struct {
+	opts   *Options
+	prefix string
+	op     proto.Message
+}
+
+func newOperation(opts *Options, prefix string, op proto.Message) *operation {
+	return &operation{opts: opts, prefix: prefix, op: op}
+}
+
+func (o *operation) field(name protoreflect.Name) (protoreflect.Value, bool) {
+	r := o.op.ProtoReflect()
+	fd := r.Descriptor().Fields().ByName(name)
+	if fd == nil || !r.Has(fd) {
+		return protoreflect.Value{}, false
+	}
+	return r.Get(fd), true
+}
+
+func (o *operation) name() string {
+	v, _ := o.field("name")
+	if !v.IsValid() {
+		return ""
+	}
+	return v.String()
+}
+
+func (o *operation) done() bool {
+	v, ok := o.field("done")
+	return ok && v.Bool()
+}
+
+// poll fetches the latest state of the operation unless it has completed.
+func (o *operation) poll(ctx context.Context, opts ...Option) error {
+	if o.done() {
+		return nil
+	}
+	opt := buildOptions(o.opts, opts...)
+	ctx, cancel := opt.withTimeout(ctx, 0)
+	defer cancel()
+	rawURL := fmt.Sprintf("%s%s/%s", opt.addr, o.prefix, escapePath(o.name(), true))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	params := req.URL.Query()
+	if err := opt.addQueryToken(ctx, params); err != nil {
+		return err
+	}
+	req.URL.RawQuery = params.Encode()
+	opt.setRequest(req)
+	if err := opt.authorize(req); err != nil {
+		return err
+	}
+	info := &CallInfo{Service: "Operations", Method: "GetOperation", Route: o.prefix + "/{name=operations/**}", Verb: http.MethodGet}
+	resp, err := opt.do(ctx, req, info)
+	if err != nil {
+		return err
+	}
+	next := o.op.ProtoReflect().New().Interface()
+	if err := opt.DoResponse(ctx, resp, next); err != nil {
+		return setErrorMethod(err, "Operations.GetOperation")
+	}
+	o.op = next
+	return nil
+}
+
+// wait polls the operation with exponential backoff until it has completed.
+func (o *operation) wait(ctx context.Context, opts ...Option) error {
+	opt := buildOptions(o.opts, opts...)
+	delay, maxDelay := opt.pollDelays()
+	for {
+		if err := o.poll(ctx, opts...); err != nil {
+			return err
+		}
+		if o.done() {
+			return nil
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		delay = time.Duration(float64(delay) * pollMultiplier)
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// pollDelays returns the initial and max delay between polls, a delay that is not positive
+// falls back to the default so that wait never polls in a tight loop.
+func (o *Options) pollDelays() (time.Duration, time.Duration) {
+	initial, max := o.pollInitialDelay, o.pollMaxDelay
+	if initial <= 0 {
+		initial = {{ .PollInitialDelay }}
+	}
+	if max < initial {
+		max = initial
+	}
+	return initial, max
+}
+
+// result decodes the response of the completed operation into res,
+// it reports false when there is no response.
+func (o *operation) result(res proto.Message) (bool, error) {
+	if !o.done() {
+		return false, nil
+	}
+	if v, ok := o.field("error"); ok {
+		st := v.Message()
+		fields := st.Descriptor().Fields()
+		return false, &OperationError{
+			Name:    o.name(),
+			Code:    int32(st.Get(fields.ByName("code")).Int()),
+			Message: st.Get(fields.ByName("message")).String(),
+		}
+	}
+	return o.unpack("response", res)
+}
+
+// metadata decodes the metadata of the operation into meta,
+// it reports false when there is no metadata.
+func (o *operation) metadata(meta proto.Message) (bool, error) {
+	return o.unpack("metadata", meta)
+}
+
+func (o *operation) unpack(name protoreflect.Name, m proto.Message) (bool, error) {
+	v, ok := o.field(name)
+	if !ok {
+		return false, nil
+	}
+	a, ok := v.Message().Interface().(*anypb.Any)
+	if !ok {
+		return false, fmt.Errorf("operation %s field %s is not google.protobuf.Any", o.name(), name)
+	}
+	if err := a.UnmarshalTo(m); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isStreamEnvelope reports whether the object is a grpc-gateway stream envelope.
+func isStreamEnvelope(env map[string]json.RawMessage) bool {
+	if len(env) == 0 {
+		return false
+	}
+	for k := range env {
+		if k != "result" && k != "error" {
+			return false
+		}
+	}
+	return true
 }
 
 func WithDoRequest(fn FnRequest) Option {
@@ -90,12 +1842,204 @@ func WithDoResponse(fn FnResponse) Option {
 	}
 }
 
+// WithPollDelay sets the initial and max delay between polls of long-running operations,
+// the delay grows exponentially. An initial delay that is not positive uses the default one.
+func WithPollDelay(initial, max time.Duration) Option {
+	return func(o *Options) {
+		o.pollInitialDelay = initial
+		o.pollMaxDelay = max
+	}
+}
+
+// WithInterceptors appends interceptors of the calls, which run in order,
+// the interceptors of the service run before the ones of the call.
+func WithInterceptors(ics ...Interceptor) Option {
+	return func(o *Options) {
+		o.interceptors = append(o.interceptors[:len(o.interceptors):len(o.interceptors)], ics...)
+	}
+}
+
+// WithHeader sets a header of the requests, replacing the values of the key.
+func WithHeader(key, value string) Option {
+	return func(o *Options) {
+		h := o.header.Clone()
+		if h == nil {
+			h = http.Header{}
+		}
+		h.Set(key, value)
+		o.header = h
+	}
+}
+
+// WithHeaders sets headers of the requests, replacing the values of the keys.
+func WithHeaders(header http.Header) Option {
+	return func(o *Options) {
+		h := o.header.Clone()
+		if h == nil {
+			h = http.Header{}
+		}
+		for k, vs := range header {
+			h[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+		}
+		o.header = h
+	}
+}
+
+// WithQueryParam sets a query parameter of the requests, replacing the values of the key.
+func WithQueryParam(key string, values ...string) Option {
+	return func(o *Options) {
+		q := make(url.Values, len(o.query)+1)
+		for k, vs := range o.query {
+			q[k] = vs
+		}
+		q[key] = append([]string(nil), values...)
+		o.query = q
+	}
+}
+
+// WithCookie adds a cookie to the requests, replacing the cookie of the same name.
+func WithCookie(c *http.Cookie) Option {
+	return func(o *Options) {
+		cookies := make([]*http.Cookie, 0, len(o.cookies)+1)
+		for _, old := range o.cookies {
+			if old.Name != c.Name {
+				cookies = append(cookies, old)
+			}
+		}
+		o.cookies = append(cookies, c)
+	}
+}
+
+// WithTokenSource sends the tokens of ts in the Authorization header, the token is cached
+// and refreshed shortly before it expires, so set it on the service to share the cache.
+func WithTokenSource(ts TokenSource) Option {
+	return func(o *Options) {
+		if _, ok := ts.(*cachedTokenSource); !ok && ts != nil {
+			ts = &cachedTokenSource{src: ts}
+		}
+		o.tokenSource = ts
+	}
+}
+
+// WithAPIKey sends the api key in the header or the query parameter of the name.
+func WithAPIKey(location APIKeyLocation, name, value string) Option {
+	return func(o *Options) {
+		o.apiKey = &apiKey{location: location, name: name, value: value}
+	}
+}
+
+// WithBasicAuth sends the username and password with http basic authentication.
+func WithBasicAuth(username, password string) Option {
+	return func(o *Options) {
+		o.basicAuth = &basicAuth{username: username, password: password}
+	}
+}
+
+// WithQueryToken sends the token of the provider in the query parameter of the name, such as access_token.
+// The token is cached until it expires, and when the errcode of a response means the token has expired,
+// the token is refreshed and the request is sent once again. Set it on the service to share the cache.
+func WithQueryToken(name string, provider TokenProvider) Option {
+	return func(o *Options) {
+		o.queryToken = &queryToken{name: name, provider: provider}
+	}
+}
+
+// WithTokenExpired sets the predicate on errcode of responses meaning the query token has expired,
+// default 40001, 40014 and 42001 of WeChat APIs.
+func WithTokenExpired(fn func(errcode int) bool) Option {
+	return func(o *Options) {
+		o.tokenExpired = fn
+	}
+}
+
+// WithSigner signs every attempt of the requests after the interceptors, with the buffered body.
+// Requests of client streaming methods can not be signed.
+func WithSigner(s Signer) Option {
+	return func(o *Options) {
+		o.signer = s
+	}
+}
+
+// WithVerifier verifies the signature of successful responses before they are decoded,
+// it is not used by a custom DoResponse.
+func WithVerifier(v Verifier) Option {
+	return func(o *Options) {
+		o.verifier = v
+	}
+}
+
+// WithTimeout sets the timeout of each call, it overrides the default timeouts of the methods.
+// The timeout does not apply to streaming methods, whose lifetime is bound to ctx.
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.timeout = d
+	}
+}
+
+// WithRetry sets the retry policy of all the methods.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *Options) {
+		o.retry = &policy
+	}
+}
+
+// WithMethodRetry sets the retry policy of one method, such as "UserService.GetUser",
+// it overrides the policy of WithRetry.
+func WithMethodRetry(method string, policy RetryPolicy) Option {
+	return func(o *Options) {
+		m := make(map[string]*RetryPolicy, len(o.methodRetry)+1)
+		for k, v := range o.methodRetry {
+			m[k] = v
+		}
+		m[method] = &policy
+		o.methodRetry = m
+	}
+}
+
+// WithMaxPages limits the pages fetched by pagination iterators, 0 means no limit.
+func WithMaxPages(n int) Option {
+	return func(o *Options) {
+		o.maxPages = n
+	}
+}
+
+// WithMaxItems limits the items returned by pagination iterators, 0 means no limit.
+func WithMaxItems(n int) Option {
+	return func(o *Options) {
+		o.maxItems = n
+	}
+}
+
+// WithMarshalOptions sets the protojson options of request bodies,
+// such as UseProtoNames and EmitUnpopulated.
+func WithMarshalOptions(mo protojson.MarshalOptions) Option {
+	return func(o *Options) {
+		o.marshalOptions = mo
+	}
+}
+
+// WithUnmarshalOptions sets the protojson options of response bodies,
+// unknown fields are discarded by default.
+func WithUnmarshalOptions(uo protojson.UnmarshalOptions) Option {
+	return func(o *Options) {
+		o.unmarshalOptions = uo
+	}
+}
+
 func WithClient(c *http.Client) Option {
 	return func(o *Options) {
 		o.client = c
 	}
 }
 
+// WithBinding selects the http binding of a method by index.
+// 0 is the primary http rule, i is the ith additional_bindings.
+func WithBinding(index int) Option {
+	return func(o *Options) {
+		o.binding = index
+	}
+}
+
 // addr must start with https:// or http://
 func WithAddr(addr string) Option {
 	return func(o *Options) {
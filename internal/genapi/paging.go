@@ -0,0 +1,109 @@
+package genapi
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// scalarGoTypes 标量字段对应的go类型
+var scalarGoTypes = map[descriptor.FieldDescriptorProto_Type]string{
+	descriptor.FieldDescriptorProto_TYPE_DOUBLE:   "float64",
+	descriptor.FieldDescriptorProto_TYPE_FLOAT:    "float32",
+	descriptor.FieldDescriptorProto_TYPE_INT64:    "int64",
+	descriptor.FieldDescriptorProto_TYPE_UINT64:   "uint64",
+	descriptor.FieldDescriptorProto_TYPE_INT32:    "int32",
+	descriptor.FieldDescriptorProto_TYPE_FIXED64:  "uint64",
+	descriptor.FieldDescriptorProto_TYPE_FIXED32:  "uint32",
+	descriptor.FieldDescriptorProto_TYPE_BOOL:     "bool",
+	descriptor.FieldDescriptorProto_TYPE_STRING:   "string",
+	descriptor.FieldDescriptorProto_TYPE_BYTES:    "[]byte",
+	descriptor.FieldDescriptorProto_TYPE_UINT32:   "uint32",
+	descriptor.FieldDescriptorProto_TYPE_SFIXED32: "int32",
+	descriptor.FieldDescriptorProto_TYPE_SFIXED64: "int64",
+	descriptor.FieldDescriptorProto_TYPE_SINT32:   "int32",
+	descriptor.FieldDescriptorProto_TYPE_SINT64:   "int64",
+}
+
+// buildPageData returns the iterator data of an AIP-158 list method, nil if the method is not paginated.
+// The request must have page_size and page_token, the response must have next_page_token
+// and a repeated field, the one with the smallest field number is iterated.
+func buildPageData(meth *descriptor.MethodDescriptorProto, imps *importSet) (*PageData, error) {
+	if meth.GetServerStreaming() || meth.GetClientStreaming() {
+		return nil, nil
+	}
+	in, ok := descInfo.Type[meth.GetInputType()].(*descriptor.DescriptorProto)
+	if !ok {
+		return nil, nil
+	}
+	out, ok := descInfo.Type[meth.GetOutputType()].(*descriptor.DescriptorProto)
+	if !ok {
+		return nil, nil
+	}
+	if !isPageSize(messageField(in, "page_size")) || !isSingularString(messageField(in, "page_token")) ||
+		!isSingularString(messageField(out, "next_page_token")) {
+		return nil, nil
+	}
+	var items *descriptor.FieldDescriptorProto
+	for _, f := range out.GetField() {
+		if f.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED || isMapField(f) {
+			continue
+		}
+		if items == nil || f.GetNumber() < items.GetNumber() {
+			items = f
+		}
+	}
+	if items == nil {
+		return nil, nil
+	}
+	typ, err := fieldGoType(items, imps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %v", meth.GetName(), items.GetName(), err)
+	}
+	return &PageData{ItemTyp: typ, ItemsField: snakeToCamel(items.GetName())}, nil
+}
+
+func messageField(msg *descriptor.DescriptorProto, name string) *descriptor.FieldDescriptorProto {
+	for _, f := range msg.GetField() {
+		if f.GetName() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func isPageSize(f *descriptor.FieldDescriptorProto) bool {
+	return f != nil && f.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED &&
+		(f.GetType() == descriptor.FieldDescriptorProto_TYPE_INT32 || f.GetType() == descriptor.FieldDescriptorProto_TYPE_INT64)
+}
+
+func isSingularString(f *descriptor.FieldDescriptorProto) bool {
+	return f != nil && f.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED &&
+		f.GetType() == descriptor.FieldDescriptorProto_TYPE_STRING
+}
+
+func isMapField(f *descriptor.FieldDescriptorProto) bool {
+	if f.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+		return false
+	}
+	msg, ok := descInfo.Type[f.GetTypeName()].(*descriptor.DescriptorProto)
+	return ok && msg.GetOptions().GetMapEntry()
+}
+
+// fieldGoType 字段单个元素的go类型，消息是指针类型
+func fieldGoType(f *descriptor.FieldDescriptorProto, imps *importSet) (string, error) {
+	switch f.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP:
+		name, err := imps.typeName(f.GetTypeName())
+		if err != nil {
+			return "", err
+		}
+		return "*" + name, nil
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return imps.typeName(f.GetTypeName())
+	}
+	if typ, ok := scalarGoTypes[f.GetType()]; ok {
+		return typ, nil
+	}
+	return "", fmt.Errorf("unsupported field type %s", f.GetType())
+}
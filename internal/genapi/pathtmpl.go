@@ -0,0 +1,95 @@
+package genapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pathVar 路由模板里的变量，如 {name=projects/*/locations/*}
+type pathVar struct {
+	field   string // 字段路径，如 info.f_child.f_string
+	pattern string // 匹配模板，没有指定或者是 * 时为空
+	multi   bool   // 是否多段，多段的变量保留 /
+}
+
+// pathPart 路由模板的一段，literal 和 variable 二选一
+type pathPart struct {
+	literal  string
+	variable *pathVar
+}
+
+// parsePathTemplate parses a google.api.http path template, e.g.
+// /v1/{name=projects/*/locations/*}/{info.f_child.f_string=second/**}:verb
+// into literal parts and variables.
+func parsePathTemplate(route string) ([]*pathPart, error) {
+	var parts []*pathPart
+	for len(route) > 0 {
+		start := strings.IndexByte(route, '{')
+		if start < 0 {
+			if strings.ContainsAny(route, "}") {
+				return nil, fmt.Errorf("unmatched '}' in path template: %s", route)
+			}
+			parts = append(parts, &pathPart{literal: route})
+			break
+		}
+		if start > 0 {
+			if strings.ContainsAny(route[:start], "}") {
+				return nil, fmt.Errorf("unmatched '}' in path template: %s", route)
+			}
+			parts = append(parts, &pathPart{literal: route[:start]})
+		}
+		end := strings.IndexByte(route[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unmatched '{' in path template: %s", route)
+		}
+		v, err := parsePathVar(route[start+1 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &pathPart{variable: v})
+		route = route[start+end+1:]
+	}
+	return parts, nil
+}
+
+func parsePathVar(s string) (*pathVar, error) {
+	if strings.ContainsAny(s, "{") {
+		return nil, fmt.Errorf("nested variable in path template: {%s}", s)
+	}
+	v := &pathVar{field: s}
+	if e := strings.IndexByte(s, '='); e >= 0 {
+		v.field, v.pattern = s[:e], s[e+1:]
+	}
+	if v.field == "" {
+		return nil, fmt.Errorf("missing field name in path variable: {%s}", s)
+	}
+	if v.pattern == "*" {
+		v.pattern = ""
+	}
+	if v.pattern == "" {
+		return v, nil
+	}
+	segs := strings.Split(v.pattern, "/")
+	for i, seg := range segs {
+		switch {
+		case seg == "":
+			return nil, fmt.Errorf("empty segment in path variable: {%s}", s)
+		case seg == "**" && i != len(segs)-1:
+			return nil, fmt.Errorf("'**' must be the last segment in path variable: {%s}", s)
+		case seg != "*" && seg != "**" && strings.ContainsAny(seg, "*"):
+			return nil, fmt.Errorf("invalid segment %q in path variable: {%s}", seg, s)
+		}
+	}
+	v.multi = len(segs) > 1 || segs[0] == "**"
+	return v, nil
+}
+
+// pathVarName 路由变量在生成代码里的变量名，如 info.f_string -> pathInfoFString
+func pathVarName(field string) string {
+	var sb strings.Builder
+	sb.WriteString("path")
+	for _, s := range strings.Split(field, ".") {
+		sb.WriteString(snakeToCamel(s))
+	}
+	return sb.String()
+}
@@ -0,0 +1,122 @@
+package genapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePathTemplate(t *testing.T) {
+	lit := func(s string) *pathPart { return &pathPart{literal: s} }
+	vari := func(field, pattern string, multi bool) *pathPart {
+		return &pathPart{variable: &pathVar{field: field, pattern: pattern, multi: multi}}
+	}
+	tests := []struct {
+		route string
+		want  []*pathPart
+	}{
+		{"/v1/users", []*pathPart{lit("/v1/users")}},
+		{"/v1/users/{name}", []*pathPart{lit("/v1/users/"), vari("name", "", false)}},
+		{"/v1/users/{name=*}", []*pathPart{lit("/v1/users/"), vari("name", "", false)}},
+		{"/v1/{name=users/*}:get", []*pathPart{lit("/v1/"), vari("name", "users/*", true), lit(":get")}},
+		{"/v1/{name=projects/*/locations/*}/{info.f_child.f_string=second/**}:verb", []*pathPart{
+			lit("/v1/"), vari("name", "projects/*/locations/*", true),
+			lit("/"), vari("info.f_child.f_string", "second/**", true), lit(":verb"),
+		}},
+		{"/v1/{path=**}", []*pathPart{lit("/v1/"), vari("path", "**", true)}},
+		{"/v1/{a}{b}", []*pathPart{lit("/v1/"), vari("a", "", false), vari("b", "", false)}},
+	}
+	for _, tt := range tests {
+		got, err := parsePathTemplate(tt.route)
+		if err != nil {
+			t.Errorf("parsePathTemplate(%q) err: %v", tt.route, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePathTemplate(%q) = %s, want %s", tt.route, dumpParts(got), dumpParts(tt.want))
+		}
+	}
+}
+
+func TestParsePathTemplateError(t *testing.T) {
+	tests := []struct {
+		route string
+		err   string
+	}{
+		{"/v1/{name", "unmatched '{'"},
+		{"/v1/name}", "unmatched '}'"},
+		{"/v1/}{name}", "unmatched '}'"},
+		{"/v1/{name={id}}", "nested variable"},
+		{"/v1/{=users/*}", "missing field name"},
+		{"/v1/{name=users//*}", "empty segment"},
+		{"/v1/{name=users/}", "empty segment"},
+		{"/v1/{name=**/users}", "'**' must be the last segment"},
+		{"/v1/{name=users/a*}", "invalid segment"},
+	}
+	for _, tt := range tests {
+		_, err := parsePathTemplate(tt.route)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parsePathTemplate(%q) err = %v, want %q", tt.route, err, tt.err)
+		}
+	}
+}
+
+func TestPathVarName(t *testing.T) {
+	if got := pathVarName("info.f_child.f_string"); got != "pathInfoFChildFString" {
+		t.Errorf("pathVarName = %s", got)
+	}
+}
+
+func dumpParts(parts []*pathPart) string {
+	var ss []string
+	for _, p := range parts {
+		if p.variable != nil {
+			ss = append(ss, "{"+p.variable.field+"="+p.variable.pattern+"}")
+			continue
+		}
+		ss = append(ss, p.literal)
+	}
+	return strings.Join(ss, " ")
+}
+
+const pathProto = `
+name: "path.proto"
+package: "path.v1"
+message_type {
+  name: "Request"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+  field { name: "info" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".path.v1.Info" json_name: "info" }
+}
+message_type {
+  name: "Info"
+  field { name: "f_child" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".path.v1.Child" json_name: "fChild" }
+}
+message_type {
+  name: "Child"
+  field { name: "f_string" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "fString" }
+}
+service {
+  name: "PathService"
+  method {
+    name: "Verb" input_type: ".path.v1.Request" output_type: ".path.v1.Request"
+    options { [google.api.http] { post: "/v1/{name=projects/*/locations/*}/{info.f_child.f_string=second/**}:verb" body: "*" } }
+  }
+}
+options { go_package: "example.com/path;path" }
+syntax: "proto3"
+`
+
+func TestGenPathTemplate(t *testing.T) {
+	code := genFiles(t, "", pathProto)["example.com/path/path.api.go"]
+	for _, want := range []string{
+		`pathName := fmt.Sprintf("%v", in.GetName())`,
+		`checkPathParam("name", pathName, "projects/*/locations/*")`,
+		`pathInfoFChildFString := fmt.Sprintf("%v", in.GetInfo().GetFChild().GetFString())`,
+		`checkPathParam("info.f_child.f_string", pathInfoFChildFString, "second/**")`,
+		`fmt.Sprintf("%s/v1/%s/%s:verb", opt.addr, escapePath(pathName, true), escapePath(pathInfoFChildFString, true))`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %s:\n%s", want, code)
+		}
+	}
+}
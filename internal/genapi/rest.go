@@ -3,10 +3,10 @@ package genapi
 import (
 	"fmt"
 	"net/http"
-	"regexp"
 	"sort"
 	"strings"
 
+	"github.com/dev-openapi/protoc-gen-go_api/goapi"
 	"github.com/dev-openapi/protoc-gen-go_api/internal/pbinfo"
 	"github.com/golang/protobuf/protoc-gen-go/descriptor"
 	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
@@ -20,33 +20,85 @@ func initDescInfo(req *plugin.CodeGeneratorRequest) {
 	descInfo = pbinfo.Of(req.GetProtoFile())
 }
 
-func genRestMethodCode(fd *descriptor.FileDescriptorProto, serv *descriptor.ServiceDescriptorProto, meth *descriptor.MethodDescriptorProto) (string, error) {
-	rest := buildRestInfo(meth)
-	if rest == nil {
+func genRestMethodCode(fd *descriptor.FileDescriptorProto, serv *descriptor.ServiceDescriptorProto, meth *descriptor.MethodDescriptorProto, resTyp, timeout string) (string, error) {
+	rests := buildRestInfos(meth)
+	if len(rests) == 0 {
 		return fmt.Sprintf(noRestyOptions, meth.GetName()), nil
 	}
 
+	data := &RequestData{
+		ServName:     serv.GetName(),
+		MethName:     meth.GetName(),
+		ResTyp:       resTyp,
+		ServerStream: meth.GetServerStreaming(),
+		ClientStream: meth.GetClientStreaming(),
+		// 标记不需要认证的方法不带认证信息
+		Unauthenticated: isUnauthenticated(meth),
+		Timeout:         timeout,
+	}
+	for _, rest := range rests {
+		code, err := genRestBindingCode(meth, rest)
+		if err != nil {
+			return "", err
+		}
+		if data.ServerStream {
+			// Messages of server streams are always decoded whole.
+			code.ResponseBody = ""
+		}
+		code.Unauthenticated = data.Unauthenticated
+		data.Bindings = append(data.Bindings, code)
+		if len(code.ResponseBody) > 0 {
+			data.HasResponseBody = true
+		}
+	}
+
+	return buildRequestCode(data)
+}
+
+func genRestBindingCode(meth *descriptor.MethodDescriptorProto, rest *restInfo) (*CodeData, error) {
 	data := &CodeData{}
 	data.Verb = strings.ToUpper(rest.verb)
+	data.Route = rest.route
+	if !isHTTPToken(data.Verb) {
+		// http.NewRequest sends an empty method as GET, so an empty custom kind must not pass.
+		return nil, fmt.Errorf("%s: custom http kind %q is not a valid http method", meth.GetName(), rest.verb)
+	}
 
-	tokens := buildRoute(rest)
-	route := rest.route
-	// TODO(noahdietz): handle more complex path urls involving = and *,
-	// e.g. v1beta1/repeat/{info.f_string=first/*}/{info.f_child.f_string=second/**}:pathtrailingresource
-	route = httpPatternVarRegex.ReplaceAllStringFunc(route, func(s string) string { return "%v" })
-	route = fmt.Sprintf("%s%s", "%s", route)
-	if len(tokens) > 0 {
-		data.RouteCode = fmt.Sprintf("rawURL := fmt.Sprintf(%q, opt.addr, %s)\n", route, strings.Join(tokens, ","))
-	} else {
-		data.RouteCode = fmt.Sprintf("rawURL := fmt.Sprintf(%q, opt.addr)\n", route)
+	route, err := buildRoute(meth, rest)
+	if err != nil {
+		return nil, err
 	}
+	data.RouteCode = route
 
+	if rest.typ == BODY_XML && !isHttpBody(meth, rest) && !meth.GetClientStreaming() {
+		if err := checkXMLBody(meth, rest); err != nil {
+			return nil, err
+		}
+	}
 	data.BodyCode = buildBody(meth, rest)
+	if meth.GetClientStreaming() {
+		// Client streams have no request message to fill the path and query,
+		// the messages are sent as newline-delimited JSON like grpc-gateway.
+		if strings.ContainsAny(rest.route, "{") {
+			return nil, fmt.Errorf("%s: client streaming route %q must not have path variables", meth.GetName(), rest.route)
+		}
+		if rest.body != "*" {
+			return nil, fmt.Errorf("%s: client streaming http rule must have body \"*\"", meth.GetName())
+		}
+		data.BodyCode, _ = buildBodyStreamCode()
+	}
+
+	if len(rest.responseBody) > 0 {
+		if lookupField(meth.GetOutputType(), rest.responseBody) == nil {
+			return nil, fmt.Errorf("%s: response_body %q is not a field of %s", meth.GetName(), rest.responseBody, meth.GetOutputType())
+		}
+		data.ResponseBody = rest.responseBody
+	}
 
-	query := buildQuery(meth)
+	query := buildQuery(meth, rest)
 	data.QueryCode = strings.Join(query, "\n\t")
 
-	return buildRequestCode(data)
+	return data, nil
 }
 
 func buildBody(m *descriptor.MethodDescriptorProto, rest *restInfo) string {
@@ -63,6 +115,10 @@ func buildBody(m *descriptor.MethodDescriptorProto, rest *restInfo) string {
 	}
 	code := strings.Builder{}
 	var bc string
+	if isHttpBody(m, rest) {
+		// google.api.HttpBody sends the data raw with its own content type.
+		typ = BODY_HTTP
+	}
 	switch typ {
 	case BODY_FORM:
 		forms := buildBodyForm(m, rest, false)
@@ -78,6 +134,10 @@ func buildBody(m *descriptor.MethodDescriptorProto, rest *restInfo) string {
 		bc, _ = buildBodyMultiCode(strings.Join(forms, "\n\t"))
 	case BODY_BYTE:
 		bc, _ = buildBodyByteCode(body)
+	case BODY_HTTP:
+		bc, _ = buildBodyHttpCode(body)
+	case BODY_XML:
+		bc, _ = buildBodyXmlCode(body, xmlRoot(m, rest))
 	default:
 		bc, _ = buildBodyJsonCode(body)
 	}
@@ -85,6 +145,14 @@ func buildBody(m *descriptor.MethodDescriptorProto, rest *restInfo) string {
 	return code.String()
 }
 
+// isHttpBody reports whether the request body of the rest rule is a google.api.HttpBody.
+func isHttpBody(m *descriptor.MethodDescriptorProto, rest *restInfo) bool {
+	if rest.body == "*" {
+		return m.GetInputType() == httpBodyType
+	}
+	return lookupField(m.GetInputType(), rest.body).GetTypeName() == httpBodyType
+}
+
 func buildBodyForm(m *descriptor.MethodDescriptorProto, rest *restInfo, multi bool) []string {
 	queryParams := map[string]*descriptor.FieldDescriptorProto{}
 	request := descInfo.Type[m.GetInputType()].(*descriptor.DescriptorProto)
@@ -115,27 +183,45 @@ func buildBodyForm(m *descriptor.MethodDescriptorProto, rest *restInfo, multi bo
 	return formParams(fmtKey, queryParams, parents...)
 }
 
-func buildRoute(rest *restInfo) []string {
-	tokens := []string{}
-	// Can't just reuse pathParams because the order matters
-	for _, path := range httpPatternVarRegex.FindAllStringSubmatch(rest.route, -1) {
-		// In the returned slice, the zeroth element is the full regex match,
-		// and the subsequent elements are the sub group matches.
-		// See the docs for FindStringSubmatch for further details.
-		tokens = append(tokens, fmt.Sprintf("in%s", fieldGetter(path[1])))
+func buildRoute(m *descriptor.MethodDescriptorProto, rest *restInfo) (string, error) {
+	parts, err := parsePathTemplate(rest.route)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", m.GetName(), err)
 	}
-	return tokens
+	var lines []string
+	route := strings.Builder{}
+	route.WriteString("%s")
+	tokens := []string{"opt.addr"}
+	// The order of parts matters, so variables are checked and escaped one by one.
+	for _, part := range parts {
+		if part.variable == nil {
+			route.WriteString(strings.ReplaceAll(part.literal, "%", "%%"))
+			continue
+		}
+		v := part.variable
+		if lookupField(m.GetInputType(), v.field) == nil {
+			return "", fmt.Errorf("%s: path variable %q is not a field of %s", m.GetName(), v.field, m.GetInputType())
+		}
+		name := pathVarName(v.field)
+		lines = append(lines, fmt.Sprintf("%s := fmt.Sprintf(%q, in%s)", name, "%v", fieldGetter(v.field)))
+		lines = append(lines, fmt.Sprintf("if err := checkPathParam(%q, %s, %q); err != nil {", v.field, name, v.pattern))
+		lines = append(lines, fmt.Sprintf("\treturn nil, fmt.Errorf(\"%s: %%w\", err)", m.GetName()))
+		lines = append(lines, "}")
+		route.WriteString("%s")
+		tokens = append(tokens, fmt.Sprintf("escapePath(%s, %t)", name, v.multi))
+	}
+	lines = append(lines, fmt.Sprintf("rawURL := fmt.Sprintf(%q, %s)", route.String(), strings.Join(tokens, ", ")))
+	return strings.Join(lines, "\n\t"), nil
 }
 
-func buildQuery(m *descriptor.MethodDescriptorProto) []string {
-	params := buildParams(m)
+func buildQuery(m *descriptor.MethodDescriptorProto, rest *restInfo) []string {
+	params := buildParams(m, rest)
 	str := `params.Add("%s", %s)`
 	return formParams(str, params)
 }
 
-func buildParams(m *descriptor.MethodDescriptorProto) map[string]*descriptor.FieldDescriptorProto {
+func buildParams(m *descriptor.MethodDescriptorProto, info *restInfo) map[string]*descriptor.FieldDescriptorProto {
 	queryParams := map[string]*descriptor.FieldDescriptorProto{}
-	info := buildRestInfo(m)
 	if info == nil {
 		return queryParams
 	}
@@ -144,7 +230,7 @@ func buildParams(m *descriptor.MethodDescriptorProto) map[string]*descriptor.Fie
 		return queryParams
 	}
 
-	pathParams := pathParams(m)
+	pathParams := pathParams(m, info)
 	// Minor hack: we want to make sure that the body parameter is NOT a query parameter.
 	pathParams[info.body] = &descriptor.FieldDescriptorProto{}
 
@@ -169,13 +255,37 @@ func buildParams(m *descriptor.MethodDescriptorProto) map[string]*descriptor.Fie
 	return queryParams
 }
 
-func buildRestInfo(m *descriptor.MethodDescriptorProto) *restInfo {
+// isUnauthenticated reports whether m is marked with option (goapi.unauthenticated) = true.
+func isUnauthenticated(m *descriptor.MethodDescriptorProto) bool {
+	if m.GetOptions() == nil {
+		return false
+	}
+	v, _ := proto.GetExtension(m.GetOptions(), goapi.E_Unauthenticated).(bool)
+	return v
+}
+
+// buildRestInfos returns the primary http rule of m followed by its additional_bindings.
+func buildRestInfos(m *descriptor.MethodDescriptorProto) []*restInfo {
 	if m == nil || m.GetOptions() == nil {
 		return nil
 	}
 	anno := proto.GetExtension(m.GetOptions(), annotations.E_Http)
 
 	rule := anno.(*annotations.HttpRule)
+	info := parseRestRule(rule)
+	if info == nil {
+		return nil
+	}
+	infos := []*restInfo{info}
+	for _, ab := range rule.GetAdditionalBindings() {
+		if ai := parseRestRule(ab); ai != nil {
+			infos = append(infos, ai)
+		}
+	}
+	return infos
+}
+
+func parseRestRule(rule *annotations.HttpRule) *restInfo {
 	info := restInfo{}
 	body := rule.GetBody()
 	if len(body) == 0 {
@@ -188,7 +298,12 @@ func buildRestInfo(m *descriptor.MethodDescriptorProto) *restInfo {
 	} else {
 		info.body = bs[0]
 		info.typ = bs[1]
+		if len(bs) > 2 && info.typ == BODY_XML {
+			// body: "*,xml,{root}" 指定xml的根元素名
+			info.xmlRoot = bs[2]
+		}
 	}
+	info.responseBody = rule.GetResponseBody()
 	switch rule.GetPattern().(type) {
 	case *annotations.HttpRule_Get:
 		info.verb = http.MethodGet
@@ -201,25 +316,46 @@ func buildRestInfo(m *descriptor.MethodDescriptorProto) *restInfo {
 		info.route = rule.GetPatch()
 	case *annotations.HttpRule_Put:
 		info.verb = http.MethodPut
-		info.verb = rule.GetPut()
+		info.route = rule.GetPut()
+	case *annotations.HttpRule_Delete:
+		info.verb = http.MethodDelete
+		info.route = rule.GetDelete()
+	case *annotations.HttpRule_Custom:
+		// custom kind is the http method, such as HEAD, OPTIONS or PURGE
+		info.verb = strings.ToUpper(rule.GetCustom().GetKind())
+		info.route = rule.GetCustom().GetPath()
+	default:
+		return nil
 	}
 	return &info
 }
 
-func pathParams(m *descriptor.MethodDescriptorProto) map[string]*descriptor.FieldDescriptorProto {
+// isHTTPToken reports whether s is a non-empty token of RFC 7230, which http methods must be.
+func isHTTPToken(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c <= ' ' || c > '~' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func pathParams(m *descriptor.MethodDescriptorProto, info *restInfo) map[string]*descriptor.FieldDescriptorProto {
 	pathParams := map[string]*descriptor.FieldDescriptorProto{}
-	info := buildRestInfo(m)
 	if info == nil {
 		return pathParams
 	}
 
-	// Match using the curly braces but don't include them in the grouping.
-	re := regexp.MustCompile("{([^}]+)}")
-	for _, p := range re.FindAllStringSubmatch(info.route, -1) {
-		// In the returned slice, the zeroth element is the full regex match,
-		// and the subsequent elements are the sub group matches.
-		// See the docs for FindStringSubmatch for further details.
-		param := strings.Split(p[1], "=")[0]
+	// Malformed templates are reported by buildRoute.
+	parts, _ := parsePathTemplate(info.route)
+	for _, p := range parts {
+		if p.variable == nil {
+			continue
+		}
+		param := p.variable.field
 		field := lookupField(m.GetInputType(), param)
 		if field == nil {
 			continue
@@ -289,11 +425,11 @@ func formParams(fmtKey string, queryParams map[string]*descriptor.FieldDescripto
 		// Handle well known protobuf types with special JSON encodings.
 		if strContains(wellKnownTypes, field.GetTypeName()) {
 			b := strings.Builder{}
-			b.WriteString(fmt.Sprintf("%s, err := json.Marshal(in%s)\n", field.GetJsonName(), accessor))
+			b.WriteString(fmt.Sprintf("%s, err := queryJSON(in%s)\n", field.GetJsonName(), accessor))
 			b.WriteString("if err != nil {\n")
 			b.WriteString("  return nil, err\n")
 			b.WriteString("}\n")
-			b.WriteString(fmt.Sprintf(fmtKey, key, fmt.Sprintf("string(%s)", field.GetJsonName())))
+			b.WriteString(fmt.Sprintf(fmtKey, key, field.GetJsonName()))
 			paramAdd = b.String()
 		} else {
 			paramAdd = fmt.Sprintf(fmtKey, key, fmt.Sprintf("fmt.Sprintf(%q, in%s)", "%v", accessor))
@@ -311,8 +447,8 @@ func formParams(fmtKey string, queryParams map[string]*descriptor.FieldDescripto
 			params = append(params, fmt.Sprintf("if items := in%s; len(items) > 0 {", accessor))
 			b := strings.Builder{}
 			b.WriteString("for _, item := range items {\n\t\t\t")
-			b.WriteString(fmt.Sprintf(fmtKey, key, fmt.Sprintf("fmt.Sprintf(%q, item)\n\t\t", "%v")))
-			b.WriteString("}")
+			b.WriteString(fmt.Sprintf(fmtKey, key, fmt.Sprintf("fmt.Sprintf(%q, item)", "%v")))
+			b.WriteString("\n\t\t}")
 			paramAdd = b.String()
 
 		} else if field.GetProto3Optional() {
@@ -0,0 +1,173 @@
+package genapi
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	_ "google.golang.org/genproto/googleapis/api/httpbody"
+)
+
+// runtimeTestModule 运行时测试的临时模块，也是gentest.textproto的go_package
+const runtimeTestModule = "example.com/gentest"
+
+// TestRuntime generates the clients of testdata/runtime/gentest.textproto into a temporary module,
+// along with the messages generated by protoc-gen-go, and runs the tests in testdata/runtime against them,
+// so the runtime code of the templates is tested as the generated clients compile it.
+func TestRuntime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip compiling the generated runtime in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	files := runtimeFiles(t)
+
+	dir, err := ioutil.TempDir("", "genapi-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files["go.mod"] = "module " + runtimeTestModule + "\n\ngo 1.16\n\nrequire (\n" +
+		"\tgoogle.golang.org/genproto " + moduleVersion(t, "google.golang.org/genproto") + "\n" +
+		"\tgoogle.golang.org/protobuf " + moduleVersion(t, "google.golang.org/protobuf") + "\n)\n"
+	sum, err := ioutil.ReadFile("../../go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["go.sum"] = string(sum)
+	tests, err := filepath.Glob("testdata/runtime/*_test.go")
+	if err != nil || len(tests) == 0 {
+		t.Fatalf("no runtime tests: %v", err)
+	}
+	for _, f := range tests {
+		bs, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[filepath.Base(f)] = string(bs)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := []string{"test", "-count=1", "-timeout=2m"}
+	if testing.Verbose() {
+		args = append(args, "-v")
+	}
+	cmd := exec.Command(goBin, append(args, ".")...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test of the generated runtime failed: %v\n%s", err, out)
+	}
+	t.Logf("%s", out)
+}
+
+// runtimeFiles returns the files generated by the plugin and protoc-gen-go for testdata/runtime/gentest.textproto.
+func runtimeFiles(t *testing.T) map[string]string {
+	bs, err := ioutil.ReadFile("testdata/runtime/gentest.textproto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &descriptor.FileDescriptorProto{}
+	if err := prototext.Unmarshal(bs, fd); err != nil {
+		t.Fatalf("parse gentest.textproto: %v", err)
+	}
+	req := &plugin.CodeGeneratorRequest{
+		Parameter:      proto.String("paths=source_relative"),
+		ProtoFile:      append(dependencies(t, fd), fd),
+		FileToGenerate: []string{fd.GetName()},
+	}
+
+	files := map[string]string{}
+	resp, err := Gen(req)
+	if err != nil {
+		t.Fatalf("Gen: %v", err)
+	}
+	for _, f := range resp.GetFile() {
+		files[f.GetName()] = f.GetContent()
+	}
+
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range gen.Files {
+		if f.Generate {
+			internal_gengo.GenerateFile(gen, f)
+		}
+	}
+	pbResp := gen.Response()
+	if pbResp.Error != nil {
+		t.Fatalf("protoc-gen-go: %s", pbResp.GetError())
+	}
+	for _, f := range pbResp.GetFile() {
+		files[f.GetName()] = f.GetContent()
+	}
+	return files
+}
+
+// dependencies returns the linked file descriptors imported by fd, each one after its own imports.
+func dependencies(t *testing.T, fd *descriptor.FileDescriptorProto) []*descriptor.FileDescriptorProto {
+	var deps []*descriptor.FileDescriptorProto
+	seen := map[string]bool{}
+	var add func(name string)
+	add = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		d, err := protoregistry.GlobalFiles.FindFileByPath(name)
+		if err != nil {
+			t.Fatalf("dependency %s: %v", name, err)
+		}
+		imports := d.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).Path())
+		}
+		deps = append(deps, protodesc.ToFileDescriptorProto(d))
+	}
+	for _, name := range fd.GetDependency() {
+		add(name)
+	}
+	return deps
+}
+
+// moduleVersion 从本仓库的go.mod里读取依赖的版本
+func moduleVersion(t *testing.T, module string) string {
+	f, err := os.Open("../../go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == module {
+			return fields[1]
+		}
+		if len(fields) >= 3 && fields[0] == "require" && fields[1] == module {
+			return fields[2]
+		}
+	}
+	t.Fatalf("%s not found in go.mod", module)
+	return ""
+}
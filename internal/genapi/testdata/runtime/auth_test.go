@@ -0,0 +1,140 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticToken returns a token source of tok that counts its calls in n.
+func staticToken(tok *Token, n *int) TokenSource {
+	return TokenSourceFunc(func() (*Token, error) {
+		if n != nil {
+			*n++
+		}
+		return tok, nil
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	srv := newTestServer(t, nil)
+	basic := WithBasicAuth("user", "pass")
+	bearer := WithTokenSource(staticToken(&Token{AccessToken: "tok"}, nil))
+	tests := []struct {
+		name          string
+		service       []Option
+		call          []Option
+		authorization string
+		apiKey        string
+		query         string
+	}{
+		{"none", nil, nil, "", "", "title=t"},
+		{"basic", []Option{basic}, nil, "Basic dXNlcjpwYXNz", "", "title=t"},
+		{"bearer", []Option{bearer}, nil, "Bearer tok", "", "title=t"},
+		{"token type", []Option{WithTokenSource(staticToken(&Token{AccessToken: "tok", TokenType: "MAC"}, nil))}, nil, "MAC tok", "", "title=t"},
+		// the token of the token source overrides basic auth
+		{"bearer over basic", []Option{basic, bearer}, nil, "Bearer tok", "", "title=t"},
+		{"bearer of call over basic", []Option{basic}, []Option{bearer}, "Bearer tok", "", "title=t"},
+		{"api key header", []Option{basic, WithAPIKey(APIKeyInHeader, "X-Api-Key", "k")}, nil, "Basic dXNlcjpwYXNz", "k", "title=t"},
+		{"api key query", []Option{bearer}, []Option{WithAPIKey(APIKeyInQuery, "key", "k")}, "Bearer tok", "", "key=k&title=t"},
+		// the api key is set last
+		{"api key in authorization", []Option{basic, bearer, WithAPIKey(APIKeyInHeader, "Authorization", "Key k")}, nil, "Key k", "", "title=t"},
+		{"api key over query param", []Option{WithQueryParam("key", "x")}, []Option{WithAPIKey(APIKeyInQuery, "key", "k")}, "", "", "key=k&title=t"},
+		// the credentials override the headers of WithHeader
+		{"basic over header", []Option{WithHeader("Authorization", "Bearer old")}, []Option{basic}, "Basic dXNlcjpwYXNz", "", "title=t"},
+		{"header without credentials", []Option{WithHeader("Authorization", "Bearer old")}, nil, "Bearer old", "", "title=t"},
+	}
+	for _, tt := range tests {
+		svc := NewBindingService(append([]Option{WithAddr(srv.URL)}, tt.service...)...)
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1", Title: "t"}, tt.call...); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		r := srv.last(t)
+		if got := r.Header.Get("Authorization"); got != tt.authorization {
+			t.Errorf("%s: Authorization = %q, want %q", tt.name, got, tt.authorization)
+		}
+		if got := r.Header.Get("X-Api-Key"); got != tt.apiKey {
+			t.Errorf("%s: X-Api-Key = %q, want %q", tt.name, got, tt.apiKey)
+		}
+		if got := r.Query.Encode(); got != tt.query {
+			t.Errorf("%s: query %q, want %q", tt.name, got, tt.query)
+		}
+	}
+}
+
+func TestAuthorizeError(t *testing.T) {
+	srv := newTestServer(t, nil)
+	errToken := errors.New("no token")
+	svc := NewBindingService(WithAddr(srv.URL), WithTokenSource(TokenSourceFunc(func() (*Token, error) {
+		return nil, errToken
+	})))
+	_, err := svc.GetBook(context.Background(), &Book{Name: "books/1"})
+	if !errors.Is(err, errToken) || !strings.Contains(err.Error(), "get token") {
+		t.Errorf("err = %v, want the error of the token source", err)
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		// tokens fetched by 3 calls
+		fetches int
+	}{
+		{"never expires", 0, 1},
+		{"valid", time.Hour, 1},
+		{"just over the delta", tokenExpiryDelta + 2*time.Second, 1},
+		// a token expiring within 10s is refreshed
+		{"within the delta", tokenExpiryDelta - 2*time.Second, 3},
+		{"expired", -time.Minute, 3},
+	}
+	for _, tt := range tests {
+		n := 0
+		tok := &Token{AccessToken: "tok"}
+		if tt.expiry != 0 {
+			tok.Expiry = time.Now().Add(tt.expiry)
+		}
+		ts := &cachedTokenSource{src: staticToken(tok, &n)}
+		for i := 0; i < 3; i++ {
+			got, err := ts.Token()
+			if err != nil || got != tok {
+				t.Fatalf("%s: Token = %v, %v", tt.name, got, err)
+			}
+		}
+		if n != tt.fetches {
+			t.Errorf("%s: %d tokens fetched, want %d", tt.name, n, tt.fetches)
+		}
+	}
+	if tokenExpiryDelta != 10*time.Second {
+		t.Errorf("tokenExpiryDelta = %v, want 10s", tokenExpiryDelta)
+	}
+}
+
+func TestTokenSourceCache(t *testing.T) {
+	srv := newTestServer(t, nil)
+	n := 0
+	ts := staticToken(&Token{AccessToken: "tok", Expiry: time.Now().Add(time.Hour)}, &n)
+
+	// the token source of the service is cached across its calls
+	svc := NewBindingService(WithAddr(srv.URL), WithTokenSource(ts))
+	for i := 0; i < 3; i++ {
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("service token source fetched %d tokens, want 1", n)
+	}
+
+	// a cached token source is not wrapped again
+	cached := &cachedTokenSource{src: ts}
+	o := newOptions(WithTokenSource(cached))
+	if o.tokenSource != cached {
+		t.Errorf("WithTokenSource wrapped the cached token source again")
+	}
+}
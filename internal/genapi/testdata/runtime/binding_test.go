@@ -0,0 +1,63 @@
+package gentest
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBinding(t *testing.T) {
+	srv := newTestServer(t, nil)
+	tests := []struct {
+		opts         []Option
+		name         string
+		method, path string
+		query, body  string
+	}{
+		{nil, "books/1", "GET", "/v1/books/1", "title=t", ""},
+		{[]Option{WithBinding(0)}, "books/1", "GET", "/v1/books/1", "title=t", ""},
+		{[]Option{WithBinding(1)}, "books/1", "POST", "/v1/books/1:get", "", `{"name":"books/1","title":"t"}`},
+		{[]Option{WithBinding(2)}, "shelves/s1/books/1", "GET", "/v2/shelves/s1/books/1", "title=t", ""},
+		// the call option overrides the binding of the service
+		{[]Option{WithBinding(2), WithBinding(0)}, "books/1", "GET", "/v1/books/1", "title=t", ""},
+	}
+	for _, tt := range tests {
+		svc := NewBindingService(WithAddr(srv.URL))
+		if _, err := svc.GetBook(context.Background(), &Book{Name: tt.name, Title: "t"}, tt.opts...); err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		r := srv.last(t)
+		if r.Method != tt.method || r.Path != tt.path || r.Query.Encode() != tt.query || strings.ReplaceAll(r.Body, " ", "") != tt.body {
+			t.Errorf("binding of %v: got %s %s?%s %s, want %s %s?%s %s", tt.path, r.Method, r.Path, r.Query.Encode(), r.Body,
+				tt.method, tt.path, tt.query, tt.body)
+		}
+	}
+
+	// the binding of the service applies to its calls
+	svc := NewBindingService(WithAddr(srv.URL), WithBinding(1))
+	if _, err := svc.GetBook(context.Background(), &Book{Name: "books/2"}); err != nil {
+		t.Fatal(err)
+	}
+	if r := srv.last(t); r.Method != "POST" || r.Path != "/v1/books/2:get" {
+		t.Errorf("binding of the service: got %s %s", r.Method, r.Path)
+	}
+}
+
+func TestBindingError(t *testing.T) {
+	srv := newTestServer(t, nil)
+	svc := NewBindingService(WithAddr(srv.URL))
+	for _, i := range []int{3, -1} {
+		_, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}, WithBinding(i))
+		if err == nil || !strings.Contains(err.Error(), "GetBook has no http binding") {
+			t.Errorf("WithBinding(%d): err = %v", i, err)
+		}
+	}
+	// the path parameter is checked against the template of the selected binding
+	if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}, WithBinding(2)); err == nil {
+		t.Error("want error of books/1 for /v2/{name=shelves/*/books/*}")
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+}
@@ -0,0 +1,148 @@
+package gentest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientStream(t *testing.T) {
+	type received struct {
+		method, path     string
+		contentType      string
+		names            []string
+		contentLength    int64
+		transferEncoding []string
+	}
+	got := make(chan received, 1)
+	srv := newStreamServer(t, func(w http.ResponseWriter, r *http.Request) {
+		rcv := received{method: r.Method, path: r.URL.Path, contentType: r.Header.Get("Content-Type"),
+			contentLength: r.ContentLength, transferEncoding: r.TransferEncoding}
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var b struct{ Name string }
+			if err := json.Unmarshal(sc.Bytes(), &b); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rcv.names = append(rcv.names, b.Name)
+		}
+		got <- rcv
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"name":"shelves/1","bookCount":"%d"}`, len(rcv.names))
+	})
+	stream, err := NewUploadService(WithAddr(srv.URL)).Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 100
+	for i := 0; i < n; i++ {
+		if err := stream.Send(&Book{Name: fmt.Sprintf("books/%d", i)}); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetName() != "shelves/1" || res.GetBookCount() != n {
+		t.Errorf("CloseAndRecv = %v", res)
+	}
+	rcv := <-got
+	if len(rcv.names) != n || rcv.names[0] != "books/0" || rcv.names[n-1] != fmt.Sprintf("books/%d", n-1) {
+		t.Errorf("server received %v", rcv.names)
+	}
+	// the messages are streamed, not buffered with a content length
+	if rcv.contentLength != -1 || len(rcv.transferEncoding) != 1 || rcv.transferEncoding[0] != "chunked" {
+		t.Errorf("content length %d transfer encoding %v, want chunked", rcv.contentLength, rcv.transferEncoding)
+	}
+	if rcv.method != "POST" || rcv.path != "/v1/books:collect" || rcv.contentType != "application/json" {
+		t.Errorf("request %s %s of %s", rcv.method, rcv.path, rcv.contentType)
+	}
+}
+
+// newStreamServer starts a server reading the request body in the handler as it is streamed.
+func newStreamServer(t *testing.T, h http.HandlerFunc) *httptest.Server {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// sendUntilEOF sends messages until Send fails, which must be io.EOF.
+func sendUntilEOF(t *testing.T, stream UploadService_CollectClient) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; time.Now().Before(deadline); i++ {
+		if err := stream.Send(&Book{Name: fmt.Sprintf("books/%d", i)}); err != nil {
+			if err != io.EOF {
+				t.Errorf("Send = %v, want io.EOF", err)
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Send does not fail after the server has answered")
+}
+
+func TestClientStreamEarlyResponse(t *testing.T) {
+	// the server answers after the first message without reading the rest
+	srv := newStreamServer(t, func(w http.ResponseWriter, r *http.Request) {
+		line, _ := bufio.NewReader(r.Body).ReadString('\n')
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Connection", "close")
+		fmt.Fprintf(w, `{"name":%q}`, strings.TrimSpace(line))
+	})
+	stream, err := NewUploadService(WithAddr(srv.URL)).Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendUntilEOF(t, stream)
+	res, err := stream.CloseAndRecv()
+	if err != nil || res.GetName() != `{"name":"books/0"}` {
+		t.Errorf("CloseAndRecv = %v, %v", res, err)
+	}
+}
+
+func TestClientStreamErrorResponse(t *testing.T) {
+	srv := newStreamServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"code":7,"message":"denied"}`))
+	})
+	stream, err := NewUploadService(WithAddr(srv.URL)).Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendUntilEOF(t, stream)
+	_, err = stream.CloseAndRecv()
+	var e *APIError
+	if !errors.As(err, &e) || e.StatusCode != http.StatusForbidden || e.Message != "denied" || e.Method != "UploadService.Collect" {
+		t.Errorf("CloseAndRecv = %v, want APIError of 403", err)
+	}
+}
+
+func TestClientStreamSigner(t *testing.T) {
+	srv := newTestServer(t, nil)
+	signer := NewHMACSHA256Signer("HMAC", []byte("key"), nil)
+	stream, err := NewUploadService(WithAddr(srv.URL), WithSigner(signer)).Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendUntilEOF(t, stream)
+	_, err = stream.CloseAndRecv()
+	if err == nil || err.Error() != "UploadService.Collect: client streaming requests can not be signed" {
+		t.Errorf("CloseAndRecv = %v, want the signer rejected", err)
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+}
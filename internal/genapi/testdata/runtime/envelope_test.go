@@ -0,0 +1,113 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// envelopeResponse decodes body with the envelope through the default DoResponse.
+func envelopeResponse(t *testing.T, env *envelope, body string) (*structpb.Struct, error) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.WriteString(body)
+	svc := newOptions()
+	svc.envelope = env
+	opt := buildOptions(svc)
+	res := &structpb.Struct{}
+	return res, opt.DoResponse(context.Background(), w.Result(), res)
+}
+
+func TestEnvelopeSuccess(t *testing.T) {
+	env := &envelope{codeField: "errcode", messageField: "errmsg", successValue: "0", dataField: "data"}
+	res, err := envelopeResponse(t, env, `{"errcode":0,"errmsg":"ok","data":{"openid":"o1"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.GetFields()["openid"].GetStringValue(); got != "o1" || len(res.GetFields()) != 1 {
+		t.Errorf("data = %v, want openid o1", res)
+	}
+
+	// without data_field the whole body is decoded
+	env = &envelope{codeField: "errcode", messageField: "errmsg", successValue: "0"}
+	res, err = envelopeResponse(t, env, `{"errcode":0,"openid":"o2"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.GetFields()["openid"].GetStringValue(); got != "o2" {
+		t.Errorf("body = %v, want openid o2", res)
+	}
+
+	// no business code is a success
+	if _, err := envelopeResponse(t, env, `{"openid":"o3"}`); err != nil {
+		t.Errorf("missing code: %v", err)
+	}
+	// null business code is a success
+	if _, err := envelopeResponse(t, env, `{"errcode":null}`); err != nil {
+		t.Errorf("null code: %v", err)
+	}
+}
+
+func TestEnvelopeBusinessError(t *testing.T) {
+	tests := []struct {
+		env           *envelope
+		body          string
+		code, message string
+	}{
+		{&envelope{codeField: "errcode", messageField: "errmsg", successValue: "0", dataField: "data"},
+			`{"errcode":40029,"errmsg":"invalid code"}`, "40029", "invalid code"},
+		{&envelope{codeField: "code", messageField: "msg", successValue: "SUCCESS"},
+			`{"code":"FAIL","msg":"签名错误"}`, "FAIL", "签名错误"},
+		{&envelope{codeField: "code", successValue: "0"},
+			`{"code":"0.0"}`, "0.0", ""},
+	}
+	for _, tt := range tests {
+		_, err := envelopeResponse(t, tt.env, tt.body)
+		var be *BusinessError
+		if !errors.As(err, &be) {
+			t.Errorf("%s: err = %v, want *BusinessError", tt.body, err)
+			continue
+		}
+		if be.Code != tt.code || be.Message != tt.message || string(be.Body) != tt.body {
+			t.Errorf("%s: BusinessError = %+v", tt.body, be)
+		}
+	}
+
+	err := setErrorMethod(&BusinessError{Code: "40001", Message: "invalid credential"}, "AuthService.Login")
+	if err.Error() != "AuthService.Login: business error 40001: invalid credential" {
+		t.Errorf("Error() = %s", err)
+	}
+}
+
+func TestEnvelopeMissingData(t *testing.T) {
+	env := &envelope{codeField: "errcode", messageField: "errmsg", successValue: "0", dataField: "data"}
+	for _, body := range []string{`{"errcode":0,"errmsg":"ok"}`, `{"errcode":0,"data":null}`} {
+		res, err := envelopeResponse(t, env, body)
+		if err != nil {
+			t.Errorf("%s: %v", body, err)
+			continue
+		}
+		if len(res.GetFields()) != 0 {
+			t.Errorf("%s: data = %v, want empty", body, res)
+		}
+	}
+}
+
+func TestEnvelopeUnwrap(t *testing.T) {
+	env := &envelope{codeField: "errcode", successValue: "0", dataField: "data"}
+	// bodies that are not a json object are returned as is
+	for _, body := range []string{`[1,2]`, `"s"`, `<xml></xml>`} {
+		bs, err := env.unwrap([]byte(body))
+		if err != nil || string(bs) != body {
+			t.Errorf("unwrap(%s) = %s, %v", body, bs, err)
+		}
+	}
+	bs, err := env.unwrap([]byte(`{"errcode":0,"data":[1,2]}`))
+	if err != nil || string(bs) != `[1,2]` {
+		t.Errorf("unwrap = %s, %v", bs, err)
+	}
+}
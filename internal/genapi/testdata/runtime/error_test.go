@@ -0,0 +1,70 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		code    int
+		message string
+		details int
+	}{
+		// google.rpc.Status nested in error, as google apis return
+		{404, `{"error":{"code":404,"message":"book not found","status":"NOT_FOUND","details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"NOT_FOUND"}]}}`,
+			404, "book not found", 1},
+		// google.rpc.Status, as grpc-gateway v2 returns
+		{404, `{"code":5,"message":"not found","details":[]}`, 5, "not found", 0},
+		// grpc-gateway v1 with the message in error
+		{500, `{"error":"boom","code":2}`, 2, "boom", 0},
+		{500, `{"error":"boom","code":2,"message":"internal"}`, 2, "internal", 0},
+		// bodies that are not a status are kept raw
+		{502, `<html>bad gateway</html>`, 0, "", 0},
+		{503, ``, 0, "", 0},
+	}
+	for _, tt := range tests {
+		srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-Id", "r1")
+			w.WriteHeader(tt.status)
+			_, _ = w.Write([]byte(tt.body))
+		})
+		svc := NewBindingService(WithAddr(srv.URL))
+		_, err := svc.GetBook(context.Background(), &Book{Name: "books/1"})
+		if !errors.Is(err, ErrNot200) {
+			t.Errorf("%s: errors.Is(%v, ErrNot200) = false", tt.body, err)
+		}
+		var e *APIError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: err = %T, want *APIError", tt.body, err)
+			continue
+		}
+		if e.Method != "BindingService.GetBook" || e.URL != srv.URL+"/v1/books/1" || e.StatusCode != tt.status ||
+			e.Status != fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status)) ||
+			e.Header.Get("X-Request-Id") != "r1" || string(e.Body) != tt.body {
+			t.Errorf("%s: APIError = %+v", tt.body, e)
+		}
+		if e.Code != tt.code || e.Message != tt.message || len(e.Details) != tt.details {
+			t.Errorf("%s: code %d message %q details %d, want %d %q %d", tt.body, e.Code, e.Message, len(e.Details), tt.code, tt.message, tt.details)
+		}
+	}
+}
+
+func TestAPIErrorString(t *testing.T) {
+	e := &APIError{Method: "BindingService.GetBook", URL: "https://x/v1/books/1", Status: "404 Not Found", Message: "book not found"}
+	if got := e.Error(); got != "BindingService.GetBook: https://x/v1/books/1: 404 Not Found: book not found" {
+		t.Errorf("Error() = %s", got)
+	}
+	if got := (&APIError{Status: "500 Internal Server Error"}).Error(); got != "500 Internal Server Error" {
+		t.Errorf("Error() = %s", got)
+	}
+	// other errors are not ErrNot200
+	if errors.Is(ErrNil, ErrNot200) || errors.Is(&BusinessError{Code: "1"}, ErrNot200) {
+		t.Error("want errors other than APIError not to be ErrNot200")
+	}
+}
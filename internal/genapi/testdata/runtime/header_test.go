@@ -0,0 +1,99 @@
+package gentest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestRequestOptions(t *testing.T) {
+	srv := newTestServer(t, nil)
+	tests := []struct {
+		name    string
+		service []Option
+		call    []Option
+		// query of the request, title=t is generated from the message
+		query string
+		// headers expected in the request
+		header http.Header
+		cookie string
+	}{
+		{"generated", nil, nil, "title=t", nil, ""},
+		{"query", nil, []Option{WithQueryParam("extra", "1", "2")}, "extra=1&extra=2&title=t", nil, ""},
+		// the options replace the query parameters generated from the message
+		{"generated query replaced", nil, []Option{WithQueryParam("title", "x")}, "title=x", nil, ""},
+		{"call query over service", []Option{WithQueryParam("title", "s"), WithQueryParam("lang", "en")},
+			[]Option{WithQueryParam("title", "c")}, "lang=en&title=c", nil, ""},
+		{"header", []Option{WithHeader("X-Tenant", "a")}, []Option{WithHeader("x-request-id", "r1")}, "title=t",
+			http.Header{"X-Tenant": {"a"}, "X-Request-Id": {"r1"}}, ""},
+		{"call header over service", []Option{WithHeader("X-Tenant", "a"), WithHeader("Accept-Language", "en")},
+			[]Option{WithHeader("X-Tenant", "b")}, "title=t",
+			http.Header{"X-Tenant": {"b"}, "Accept-Language": {"en"}}, ""},
+		// WithHeaders canonicalizes the keys and keeps all the values
+		{"headers", []Option{WithHeader("X-Tenant", "a")}, []Option{WithHeaders(http.Header{"x-tenant": {"b", "c"}, "x-other": {"o"}})}, "title=t",
+			http.Header{"X-Tenant": {"b", "c"}, "X-Other": {"o"}}, ""},
+		{"header after headers", nil, []Option{WithHeaders(http.Header{"X-Tenant": {"b", "c"}}), WithHeader("X-Tenant", "d")}, "title=t",
+			http.Header{"X-Tenant": {"d"}}, ""},
+		{"cookies", []Option{WithCookie(&http.Cookie{Name: "a", Value: "1"})}, []Option{WithCookie(&http.Cookie{Name: "b", Value: "2"})}, "title=t",
+			nil, "a=1; b=2"},
+		// a cookie of the call replaces the cookie of the same name of the service
+		{"call cookie over service", []Option{WithCookie(&http.Cookie{Name: "a", Value: "1"}), WithCookie(&http.Cookie{Name: "b", Value: "2"})},
+			[]Option{WithCookie(&http.Cookie{Name: "a", Value: "3"})}, "title=t", nil, "b=2; a=3"},
+	}
+	for _, tt := range tests {
+		svc := NewBindingService(append([]Option{WithAddr(srv.URL)}, tt.service...)...)
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1", Title: "t"}, tt.call...); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		r := srv.last(t)
+		if got := r.Query.Encode(); got != tt.query {
+			t.Errorf("%s: query %q, want %q", tt.name, got, tt.query)
+		}
+		for k, want := range tt.header {
+			if got := r.Header.Values(k); !equalNames(got, want) {
+				t.Errorf("%s: header %s = %q, want %q", tt.name, k, got, want)
+			}
+		}
+		if got := r.Header.Get("Cookie"); got != tt.cookie {
+			t.Errorf("%s: Cookie = %q, want %q", tt.name, got, tt.cookie)
+		}
+	}
+}
+
+func TestRequestOptionsBody(t *testing.T) {
+	// WithHeader replaces the content type generated for the body
+	srv := newTestServer(t, nil)
+	svc := NewBindingService(WithAddr(srv.URL), WithBinding(1))
+	if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if ct := srv.last(t).Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}, WithHeader("Content-Type", "application/json; charset=utf-8")); err != nil {
+		t.Fatal(err)
+	}
+	if ct := srv.last(t).Header.Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want the one of WithHeader", ct)
+	}
+
+	// the options of a call do not change the service
+	svc = NewBindingService(WithAddr(srv.URL), WithHeader("X-Tenant", "a"), WithQueryParam("lang", "en"))
+	tests := []struct {
+		opts         []Option
+		tenant, lang string
+		cookie       string
+	}{
+		{[]Option{WithHeader("X-Tenant", "b"), WithQueryParam("lang", "fr"), WithCookie(&http.Cookie{Name: "a", Value: "1"})}, "b", "fr", "a=1"},
+		{nil, "a", "en", ""},
+	}
+	for i, tt := range tests {
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}, tt.opts...); err != nil {
+			t.Fatal(err)
+		}
+		r := srv.last(t)
+		if r.Header.Get("X-Tenant") != tt.tenant || r.Query.Get("lang") != tt.lang || r.Header.Get("Cookie") != tt.cookie {
+			t.Errorf("call %d: X-Tenant %q lang %q Cookie %q", i, r.Header.Get("X-Tenant"), r.Query.Get("lang"), r.Header.Get("Cookie"))
+		}
+	}
+}
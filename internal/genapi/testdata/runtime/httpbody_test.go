@@ -0,0 +1,79 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+)
+
+func TestHttpBodyRequest(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, nil)
+	svc := NewMediaService(WithAddr(srv.URL))
+	data := "\x00\x01raw,not json\n"
+
+	if _, err := svc.UploadRaw(ctx, &httpbody.HttpBody{ContentType: "image/png", Data: []byte(data)}); err != nil {
+		t.Fatal(err)
+	}
+	r := srv.last(t)
+	if r.Method != "POST" || r.Path != "/v1/raw" || r.Body != data || r.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("UploadRaw sent %s %s %q of %s", r.Method, r.Path, r.Body, r.Header.Get("Content-Type"))
+	}
+
+	// the body field is sent raw, the other fields fill the path
+	in := &UploadRequest{Name: "files/a.txt", File: &httpbody.HttpBody{ContentType: "text/plain", Data: []byte(data)}}
+	if _, err := svc.UploadFile(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+	r = srv.last(t)
+	if r.Method != "PUT" || r.Path != "/v1/files/a.txt" || r.Body != data || r.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("UploadFile sent %s %s %q of %s", r.Method, r.Path, r.Body, r.Header.Get("Content-Type"))
+	}
+
+	// without a content type no Content-Type is sent
+	if _, err := svc.UploadRaw(ctx, &httpbody.HttpBody{Data: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	if r = srv.last(t); r.Body != "x" || r.Header.Get("Content-Type") != "" {
+		t.Errorf("UploadRaw sent %q of %q", r.Body, r.Header.Get("Content-Type"))
+	}
+}
+
+func TestHttpBodyResponse(t *testing.T) {
+	data := "%PDF-1.4 \x00\xff"
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte(data))
+	})
+	res, err := NewMediaService(WithAddr(srv.URL)).Download(context.Background(), &Book{Name: "files/a.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetContentType() != "application/pdf" || string(res.GetData()) != data {
+		t.Errorf("Download = %q %q", res.GetContentType(), res.GetData())
+	}
+	if r := srv.last(t); r.Path != "/v1/files/a.pdf:download" {
+		t.Errorf("path = %s", r.Path)
+	}
+
+	// json bodies are not decoded either
+	srv = jsonServer(t, `{"contentType":"x","data":"eA=="}`)
+	res, err = NewMediaService(WithAddr(srv.URL)).Download(context.Background(), &Book{Name: "files/a.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetContentType() != "application/json" || string(res.GetData()) != `{"contentType":"x","data":"eA=="}` {
+		t.Errorf("Download = %q %q", res.GetContentType(), res.GetData())
+	}
+
+	// errors are still APIError
+	srv = newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	})
+	if _, err = NewMediaService(WithAddr(srv.URL)).Download(context.Background(), &Book{Name: "files/a"}); !errors.Is(err, ErrNot200) {
+		t.Errorf("err = %v, want ErrNot200", err)
+	}
+}
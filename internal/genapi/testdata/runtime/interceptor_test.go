@@ -0,0 +1,120 @@
+package gentest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// tracer returns an interceptor recording its name before and after next in trace.
+func tracer(name string, trace *[]string) Interceptor {
+	return func(ctx context.Context, info *CallInfo, req *http.Request, next Invoker) (*http.Response, error) {
+		*trace = append(*trace, name+">")
+		resp, err := next(ctx, info, req)
+		*trace = append(*trace, "<"+name)
+		return resp, err
+	}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	srv := newTestServer(t, nil)
+	var trace []string
+	a, b, c, d := tracer("a", &trace), tracer("b", &trace), tracer("c", &trace), tracer("d", &trace)
+	tests := []struct {
+		name    string
+		service []Option
+		call    []Option
+		want    string
+	}{
+		{"none", nil, nil, ""},
+		{"service", []Option{WithInterceptors(a, b)}, nil, "a> b> <b <a"},
+		{"call", nil, []Option{WithInterceptors(a, b)}, "a> b> <b <a"},
+		// the interceptors of the service run before the ones of the call
+		{"service and call", []Option{WithInterceptors(a, b)}, []Option{WithInterceptors(c)}, "a> b> c> <c <b <a"},
+		// each option appends its interceptors
+		{"appended", []Option{WithInterceptors(a), WithInterceptors(b)}, []Option{WithInterceptors(c), WithInterceptors(d)},
+			"a> b> c> d> <d <c <b <a"},
+	}
+	for _, tt := range tests {
+		svc := NewBindingService(append([]Option{WithAddr(srv.URL)}, tt.service...)...)
+		// the interceptors of a call do not stay on the service
+		for i := 0; i < 2; i++ {
+			trace = nil
+			if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}, tt.call...); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got := strings.Join(trace, " "); got != tt.want {
+				t.Errorf("%s: call %d ran %q, want %q", tt.name, i, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestInterceptorCallInfo(t *testing.T) {
+	srv := newTestServer(t, nil)
+	tests := []struct {
+		opts []Option
+		want CallInfo
+	}{
+		{nil, CallInfo{Service: "BindingService", Method: "GetBook", Route: "/v1/{name=books/*}", Verb: "GET"}},
+		{[]Option{WithBinding(1)}, CallInfo{Service: "BindingService", Method: "GetBook", Route: "/v1/{name=books/*}:get", Verb: "POST"}},
+	}
+	for _, tt := range tests {
+		var got CallInfo
+		ic := func(ctx context.Context, info *CallInfo, req *http.Request, next Invoker) (*http.Response, error) {
+			got = *info
+			return next(ctx, info, req)
+		}
+		svc := NewBindingService(WithAddr(srv.URL), WithInterceptors(ic))
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}, tt.opts...); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CallInfo = %+v, want %+v", got, tt.want)
+		}
+	}
+}
+
+func TestInterceptorRequest(t *testing.T) {
+	// an interceptor changes the request, and runs once around the retries
+	srv := failingServer(t, 2, 503, nil)
+	calls := 0
+	ic := func(ctx context.Context, info *CallInfo, req *http.Request, next Invoker) (*http.Response, error) {
+		calls++
+		req.Header.Set("X-Trace", "t1")
+		return next(ctx, info, req)
+	}
+	svc := NewBindingService(WithAddr(srv.URL), WithInterceptors(ic), WithRetry(fastRetry(RetryPolicy{})))
+	if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := srv.requests()
+	if calls != 1 || len(reqs) != 3 {
+		t.Errorf("interceptor called %d times for %d attempts, want 1 for 3", calls, len(reqs))
+	}
+	for i, r := range reqs {
+		if r.Header.Get("X-Trace") != "t1" {
+			t.Errorf("attempt %d: X-Trace = %q", i, r.Header.Get("X-Trace"))
+		}
+	}
+
+	// an interceptor answers without calling next
+	srv = newTestServer(t, nil)
+	cached := func(ctx context.Context, info *CallInfo, req *http.Request, next Invoker) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"name":"books/1","title":"cached"}`)),
+			Request:    req,
+		}, nil
+	}
+	res, err := NewBindingService(WithAddr(srv.URL), WithInterceptors(cached)).GetBook(context.Background(), &Book{Name: "books/1"})
+	if err != nil || res.GetTitle() != "cached" {
+		t.Errorf("GetBook = %v, %v, want the cached book", res, err)
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+}
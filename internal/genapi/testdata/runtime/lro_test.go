@@ -0,0 +1,80 @@
+package gentest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newOperationMessage returns a message with the name and done fields of google.longrunning.Operation.
+func newOperationMessage(t *testing.T) proto.Message {
+	t.Helper()
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("op.proto"),
+		Package: proto.String("gentest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Operation"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("name"), Number: proto.Int32(1), JsonName: proto.String("name"),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+				{Name: proto.String("done"), Number: proto.Int32(3), JsonName: proto.String("done"),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum()},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := dynamicpb.NewMessage(fd.Messages().ByName("Operation"))
+	op.Set(op.Descriptor().Fields().ByName("name"), protoreflect.ValueOfString("operations/1"))
+	return op
+}
+
+func TestPollDelays(t *testing.T) {
+	tests := []struct {
+		initial, max         time.Duration
+		wantInitial, wantMax time.Duration
+	}{
+		{time.Millisecond, time.Second, time.Millisecond, time.Second},
+		{0, 0, time.Second, time.Second},
+		{-time.Second, time.Minute, time.Second, time.Minute},
+		{time.Second, 0, time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		o := newOptions(WithPollDelay(tt.initial, tt.max))
+		initial, max := o.pollDelays()
+		if initial != tt.wantInitial || max != tt.wantMax {
+			t.Errorf("pollDelays(%v, %v) = %v, %v, want %v, %v", tt.initial, tt.max, initial, max, tt.wantInitial, tt.wantMax)
+		}
+	}
+}
+
+func TestWaitZeroDelay(t *testing.T) {
+	var polls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&polls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"operations/1","done":false}`))
+	}))
+	defer srv.Close()
+
+	op := newOperation(newOptions(WithAddr(srv.URL), WithPollDelay(0, 0)), "/v1", newOperationMessage(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := op.wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("wait err = %v", err)
+	}
+	if n := atomic.LoadInt32(&polls); n != 1 {
+		t.Errorf("polled %d times in 200ms with zero delay, want 1", n)
+	}
+}
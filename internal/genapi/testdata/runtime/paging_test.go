@@ -0,0 +1,200 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// bookPages are the pages of the library server by page token, with the token of the next page,
+// the page of p3 is empty but not the last one.
+var bookPages = map[string]struct {
+	books []string
+	next  string
+}{
+	"":   {[]string{"books/0", "books/1"}, "p2"},
+	"p2": {[]string{"books/2", "books/3"}, "p3"},
+	"p3": {nil, "p4"},
+	"p4": {[]string{"books/4"}, ""},
+}
+
+// libraryServer answers ListBooks with bookPages, and with a 500 for the page token of fail.
+func libraryServer(t *testing.T, fail string) *testServer {
+	return newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("page_token")
+		page, ok := bookPages[token]
+		if !ok || token == fail && fail != "" {
+			http.Error(w, `{"code":13,"message":"page `+token+`"}`, http.StatusInternalServerError)
+			return
+		}
+		books := make([]string, len(page.books))
+		for i, name := range page.books {
+			books[i] = fmt.Sprintf(`{"name":%q}`, name)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"books":[%s],"nextPageToken":%q}`, strings.Join(books, ","), page.next)
+	})
+}
+
+// pageTokens returns the page tokens of the requests received by srv.
+func pageTokens(srv *testServer) []string {
+	var tokens []string
+	for _, r := range srv.requests() {
+		tokens = append(tokens, r.Query.Get("page_token"))
+	}
+	return tokens
+}
+
+// nextAll returns the names of the books returned by Next until ErrIteratorDone.
+func nextAll(t *testing.T, it *LibraryListBooksIterator) []string {
+	t.Helper()
+	var names []string
+	for len(names) <= len(bookPages)*2 {
+		b, err := it.Next()
+		if err == ErrIteratorDone {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, b.GetName())
+	}
+	t.Fatalf("Next does not end after %v", names)
+	return nil
+}
+
+func TestIterNext(t *testing.T) {
+	srv := libraryServer(t, "")
+	it := NewLibraryService(WithAddr(srv.URL)).ListBooksIter(context.Background(), &ListBooksRequest{Parent: "shelves/1", PageSize: 2})
+	if it.Response() != nil || it.PageToken() != "" {
+		t.Errorf("before the first page: response %v page token %q", it.Response(), it.PageToken())
+	}
+	if names := nextAll(t, it); !equalNames(names, []string{"books/0", "books/1", "books/2", "books/3", "books/4"}) {
+		t.Errorf("Next returned %v", names)
+	}
+	// the iterator stays done without fetching again
+	if _, err := it.Next(); err != ErrIteratorDone {
+		t.Errorf("Next after the last page = %v, want ErrIteratorDone", err)
+	}
+	if !equalNames(pageTokens(srv), []string{"", "p2", "p3", "p4"}) {
+		t.Errorf("page tokens %v", pageTokens(srv))
+	}
+	for _, r := range srv.requests() {
+		if r.Path != "/v1/shelves/1/books" || r.Query.Get("page_size") != "2" {
+			t.Errorf("request %s?%s", r.Path, r.Query.Encode())
+		}
+	}
+	if it.PageToken() != "" || it.Response() == nil || it.Response().GetBooks()[0].GetName() != "books/4" {
+		t.Errorf("after the last page: response %v page token %q", it.Response(), it.PageToken())
+	}
+}
+
+func TestIterNextPage(t *testing.T) {
+	srv := libraryServer(t, "")
+	it := NewLibraryService(WithAddr(srv.URL)).ListBooksIter(context.Background(), &ListBooksRequest{Parent: "shelves/1"})
+	tests := []struct {
+		books []string
+		token string
+	}{
+		{[]string{"books/0", "books/1"}, "p2"},
+		{[]string{"books/2", "books/3"}, "p3"},
+		{nil, "p4"},
+		{[]string{"books/4"}, ""},
+	}
+	for i, tt := range tests {
+		page, err := it.NextPage()
+		if err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		var names []string
+		for _, b := range page {
+			names = append(names, b.GetName())
+		}
+		if !equalNames(names, tt.books) || it.PageToken() != tt.token {
+			t.Errorf("page %d: %v with token %q, want %v with %q", i, names, it.PageToken(), tt.books, tt.token)
+		}
+	}
+	if _, err := it.NextPage(); err != ErrIteratorDone {
+		t.Errorf("NextPage after the last page = %v, want ErrIteratorDone", err)
+	}
+}
+
+func TestIterLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		token string
+		books []string
+		// page tokens of the requests
+		pages []string
+		// PageToken after the iteration
+		next string
+	}{
+		{"no limit", nil, "", []string{"books/0", "books/1", "books/2", "books/3", "books/4"}, []string{"", "p2", "p3", "p4"}, ""},
+		{"max pages", []Option{WithMaxPages(2)}, "", []string{"books/0", "books/1", "books/2", "books/3"}, []string{"", "p2"}, "p3"},
+		// the empty page counts as a page
+		{"max pages of empty page", []Option{WithMaxPages(3)}, "", []string{"books/0", "books/1", "books/2", "books/3"}, []string{"", "p2", "p3"}, "p4"},
+		// the items of the last page are truncated
+		{"max items", []Option{WithMaxItems(3)}, "", []string{"books/0", "books/1", "books/2"}, []string{"", "p2"}, "p3"},
+		{"max items at page end", []Option{WithMaxItems(2)}, "", []string{"books/0", "books/1"}, []string{""}, "p2"},
+		{"both limits", []Option{WithMaxPages(1), WithMaxItems(3)}, "", []string{"books/0", "books/1"}, []string{""}, "p2"},
+		// the page token of the request resumes the iteration
+		{"resume", nil, "p2", []string{"books/2", "books/3", "books/4"}, []string{"p2", "p3", "p4"}, ""},
+	}
+	for _, tt := range tests {
+		srv := libraryServer(t, "")
+		svc := NewLibraryService(WithAddr(srv.URL))
+		it := svc.ListBooksIter(context.Background(), &ListBooksRequest{Parent: "shelves/1", PageToken: tt.token}, tt.opts...)
+		if names := nextAll(t, it); !equalNames(names, tt.books) {
+			t.Errorf("%s: items %v, want %v", tt.name, names, tt.books)
+		}
+		if !equalNames(pageTokens(srv), tt.pages) {
+			t.Errorf("%s: page tokens %v, want %v", tt.name, pageTokens(srv), tt.pages)
+		}
+		if it.PageToken() != tt.next {
+			t.Errorf("%s: PageToken = %q, want %q", tt.name, it.PageToken(), tt.next)
+		}
+	}
+
+	// the limits of the service apply to its iterators
+	srv := libraryServer(t, "")
+	it := NewLibraryService(WithAddr(srv.URL), WithMaxPages(1)).ListBooksIter(context.Background(), &ListBooksRequest{Parent: "shelves/1"})
+	if page, err := it.NextPage(); err != nil || len(page) != 2 {
+		t.Fatalf("NextPage = %v, %v", page, err)
+	}
+	if _, err := it.NextPage(); err != ErrIteratorDone {
+		t.Errorf("NextPage over WithMaxPages of the service = %v, want ErrIteratorDone", err)
+	}
+}
+
+func TestIterError(t *testing.T) {
+	srv := libraryServer(t, "p2")
+	it := NewLibraryService(WithAddr(srv.URL)).ListBooksIter(context.Background(), &ListBooksRequest{Parent: "shelves/1"})
+	for i := 0; i < 2; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := it.Next()
+	var e *APIError
+	if !errors.As(err, &e) || e.Message != "page p2" {
+		t.Fatalf("Next = %v, want APIError of page p2", err)
+	}
+	// the error is kept, the page is not fetched again
+	if _, err2 := it.Next(); err2 != err {
+		t.Errorf("Next after the error = %v, want %v", err2, err)
+	}
+	if _, err2 := it.NextPage(); err2 != err {
+		t.Errorf("NextPage after the error = %v, want %v", err2, err)
+	}
+	if !equalNames(pageTokens(srv), []string{"", "p2"}) {
+		t.Errorf("page tokens %v", pageTokens(srv))
+	}
+	// the token of the failed page is kept to resume later
+	if it.PageToken() != "p2" {
+		t.Errorf("PageToken = %q, want p2", it.PageToken())
+	}
+}
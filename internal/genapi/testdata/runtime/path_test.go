@@ -0,0 +1,68 @@
+package gentest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPathParam(t *testing.T) {
+	tests := []struct {
+		v, pattern string
+		ok         bool
+	}{
+		{"users", "", true},
+		{"a/b", "", true},
+		{"projects/p1/locations/l1", "projects/*/locations/*", true},
+		{"projects/p1/locations", "projects/*/locations/*", false},
+		{"projects/p1/locations/l1/x", "projects/*/locations/*", false},
+		{"projects//locations/l1", "projects/*/locations/*", false},
+		{"folders/p1/locations/l1", "projects/*/locations/*", false},
+		{"second/a", "second/**", true},
+		{"second/a/b/c", "second/**", true},
+		{"second", "second/**", true}, // ** matches zero or more segments
+		{"second/a//c", "second/**", false},
+		{"second/a/", "second/**", false},
+		{"first/a", "second/**", false},
+		{"a/b/c", "**", true},
+		{"", "", false},
+		{"", "**", false},
+	}
+	for _, tt := range tests {
+		err := checkPathParam("name", tt.v, tt.pattern)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkPathParam(%q, %q) err = %v, want ok %v", tt.v, tt.pattern, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckPathParamError(t *testing.T) {
+	err := checkPathParam("name", "folders/1", "projects/*")
+	if err == nil || !strings.Contains(err.Error(), `path parameter "name" value "folders/1" does not match "projects/*"`) {
+		t.Errorf("err = %v", err)
+	}
+	err = checkPathParam("name", "", "")
+	if err == nil || !strings.Contains(err.Error(), `path parameter "name" is empty`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct {
+		s     string
+		multi bool
+		want  string
+	}{
+		{"abc-_.~09AZ", false, "abc-_.~09AZ"},
+		{"a/b", false, "a%2Fb"},
+		{"a/b", true, "a/b"},
+		{"second/a b/c?d", true, "second/a%20b/c%3Fd"},
+		{"x%y#z", true, "x%25y%23z"},
+		{"中", false, "%E4%B8%AD"},
+		{"projects/p1/locations/l:1", true, "projects/p1/locations/l%3A1"},
+	}
+	for _, tt := range tests {
+		if got := escapePath(tt.s, tt.multi); got != tt.want {
+			t.Errorf("escapePath(%q, %v) = %q, want %q", tt.s, tt.multi, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenServer answers with the errcode of the access_token of the request in codes,
+// and with a book when the token has no errcode.
+func tokenServer(t *testing.T, codes map[string]int) *testServer {
+	return newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if code, ok := codes[r.URL.Query().Get("access_token")]; ok {
+			fmt.Fprintf(w, `{"errcode":%d,"errmsg":"access_token expired"}`, code)
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"name":"books/1","title":"ok"}`))
+	})
+}
+
+// countingProvider returns the tokens t1, t2, ... and counts them in n.
+func countingProvider(n *int) TokenProvider {
+	return TokenProviderFunc(func(ctx context.Context) (string, time.Duration, error) {
+		*n++
+		return fmt.Sprintf("t%d", *n), time.Hour, nil
+	})
+}
+
+// withWxEnvelope checks the errcode of the responses as the goapi envelope annotation of WeChat APIs does.
+func withWxEnvelope(o *Options) {
+	o.envelope = &envelope{codeField: "errcode", messageField: "errmsg", successValue: "0"}
+}
+
+// accessTokens returns the access tokens of the requests received by srv.
+func accessTokens(srv *testServer) []string {
+	var tokens []string
+	for _, r := range srv.requests() {
+		tokens = append(tokens, r.Query.Get("access_token"))
+	}
+	return tokens
+}
+
+func TestQueryTokenRefresh(t *testing.T) {
+	tests := []struct {
+		name         string
+		binding      int
+		method, path string
+	}{
+		{"get", 0, "GET", "/v1/books/1"},
+		// the body is sent again with the new token
+		{"post", 1, "POST", "/v1/books/1:get"},
+	}
+	for _, tt := range tests {
+		srv := tokenServer(t, map[string]int{"t1": 42001})
+		fetched := 0
+		svc := NewBindingService(WithAddr(srv.URL), WithBinding(tt.binding), withWxEnvelope,
+			WithQueryToken("access_token", countingProvider(&fetched)))
+		res, err := svc.GetBook(context.Background(), &Book{Name: "books/1", Title: "t"})
+		if err != nil || res.GetTitle() != "ok" {
+			t.Fatalf("%s: GetBook = %v, %v", tt.name, res, err)
+		}
+		if fetched != 2 {
+			t.Errorf("%s: %d tokens fetched, want 2", tt.name, fetched)
+		}
+		reqs := srv.requests()
+		if !equalNames(accessTokens(srv), []string{"t1", "t2"}) {
+			t.Fatalf("%s: access tokens %v, want [t1 t2]", tt.name, accessTokens(srv))
+		}
+		// the request is sent again the same, but with the new token
+		for i, r := range reqs {
+			if r.Method != tt.method || r.Path != tt.path || r.Query.Get("title") != reqs[0].Query.Get("title") || r.Body != reqs[0].Body {
+				t.Errorf("%s: request %d %s %s?%s %q", tt.name, i, r.Method, r.Path, r.Query.Encode(), r.Body)
+			}
+		}
+		if tt.method == "POST" && !strings.Contains(reqs[1].Body, `"title":"t"`) {
+			t.Errorf("%s: body %q sent again", tt.name, reqs[1].Body)
+		}
+
+		// the new token is cached for the next calls
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}); err != nil {
+			t.Fatal(err)
+		}
+		if fetched != 2 || !equalNames(accessTokens(srv), []string{"t1", "t2", "t2"}) {
+			t.Errorf("%s: %d tokens fetched, access tokens %v", tt.name, fetched, accessTokens(srv))
+		}
+	}
+}
+
+func TestQueryTokenExpiredAgain(t *testing.T) {
+	// the token of the refresh has expired too, the response is returned without another refresh
+	srv := tokenServer(t, map[string]int{"t1": 42001, "t2": 40001})
+	fetched := 0
+	svc := NewBindingService(WithAddr(srv.URL), withWxEnvelope, WithQueryToken("access_token", countingProvider(&fetched)))
+	_, err := svc.GetBook(context.Background(), &Book{Name: "books/1"})
+	var e *BusinessError
+	if !errors.As(err, &e) || e.Code != "40001" || e.Method != "BindingService.GetBook" {
+		t.Errorf("err = %v, want the business error 40001", err)
+	}
+	if fetched != 2 || !equalNames(accessTokens(srv), []string{"t1", "t2"}) {
+		t.Errorf("%d tokens fetched, access tokens %v, want 2 and [t1 t2]", fetched, accessTokens(srv))
+	}
+}
+
+func TestQueryTokenExpiredPredicate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		code    int
+		fetched int
+		// business code of the error returned, empty for success
+		errCode string
+	}{
+		{"default", nil, 42001, 2, ""},
+		{"default other errcode", nil, 40013, 1, "40013"},
+		{"custom", []Option{WithTokenExpired(func(code int) bool { return code == 40099 })}, 40099, 2, ""},
+		// the custom predicate replaces the default errcodes
+		{"custom default errcode", []Option{WithTokenExpired(func(code int) bool { return code == 40099 })}, 42001, 1, "42001"},
+	}
+	for _, tt := range tests {
+		srv := tokenServer(t, map[string]int{"t1": tt.code})
+		fetched := 0
+		opts := append([]Option{WithAddr(srv.URL), withWxEnvelope, WithQueryToken("access_token", countingProvider(&fetched))}, tt.opts...)
+		_, err := NewBindingService(opts...).GetBook(context.Background(), &Book{Name: "books/1"})
+		var e *BusinessError
+		if tt.errCode == "" && err != nil || tt.errCode != "" && (!errors.As(err, &e) || e.Code != tt.errCode) {
+			t.Errorf("%s: err = %v, want business code %q", tt.name, err, tt.errCode)
+		}
+		if fetched != tt.fetched || len(srv.requests()) != tt.fetched {
+			t.Errorf("%s: %d tokens fetched for %d requests, want %d", tt.name, fetched, len(srv.requests()), tt.fetched)
+		}
+	}
+}
+
+func TestQueryTokenError(t *testing.T) {
+	srv := newTestServer(t, nil)
+	errFetch := errors.New("token endpoint down")
+	svc := NewBindingService(WithAddr(srv.URL), WithQueryToken("access_token", TokenProviderFunc(func(ctx context.Context) (string, time.Duration, error) {
+		return "", 0, errFetch
+	})))
+	if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}); !errors.Is(err, errFetch) {
+		t.Errorf("err = %v, want the error of the provider", err)
+	}
+	if n := len(srv.requests()); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+}
@@ -0,0 +1,75 @@
+package gentest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// jsonServer answers every request with the json body.
+func jsonServer(t *testing.T, body string) *testServer {
+	return newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+func TestResponseBody(t *testing.T) {
+	ctx := context.Background()
+	in := &Shelf{Name: "shelves/1"}
+
+	srv := jsonServer(t, `{"name":"b1","title":"t1"}`)
+	res, err := NewShelfService(WithAddr(srv.URL)).GetShelfBook(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Shelf{Book: &Book{Name: "b1", Title: "t1"}}); !proto.Equal(res, want) {
+		t.Errorf("GetShelfBook = %v, want %v", res, want)
+	}
+
+	// the additional binding without response_body decodes the whole body
+	srv = jsonServer(t, `{"name":"shelves/1","book":{"name":"b1"}}`)
+	res, err = NewShelfService(WithAddr(srv.URL)).GetShelfBook(ctx, in, WithBinding(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Shelf{Name: "shelves/1", Book: &Book{Name: "b1"}}); !proto.Equal(res, want) {
+		t.Errorf("GetShelfBook of binding 1 = %v, want %v", res, want)
+	}
+	if r := srv.last(t); r.Path != "/v2/shelves/1" {
+		t.Errorf("path = %s", r.Path)
+	}
+
+	// repeated and scalar fields
+	srv = jsonServer(t, `[{"name":"b1"},{"name":"b2","unknown":1}]`)
+	res, err = NewShelfService(WithAddr(srv.URL)).ListShelfBooks(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Shelf{Books: []*Book{{Name: "b1"}, {Name: "b2"}}}); !proto.Equal(res, want) {
+		t.Errorf("ListShelfBooks = %v, want %v", res, want)
+	}
+	srv = jsonServer(t, `"42"`)
+	res, err = NewShelfService(WithAddr(srv.URL)).CountShelfBooks(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetBookCount() != 42 {
+		t.Errorf("CountShelfBooks = %v, want 42", res)
+	}
+}
+
+func TestResponseBodyError(t *testing.T) {
+	srv := jsonServer(t, `{"name":1}`)
+	if _, err := NewShelfService(WithAddr(srv.URL)).GetShelfBook(context.Background(), &Shelf{Name: "shelves/1"}); err == nil {
+		t.Error("want error of an invalid field value")
+	}
+	// an empty body leaves the response empty
+	srv = jsonServer(t, ``)
+	res, err := NewShelfService(WithAddr(srv.URL)).GetShelfBook(context.Background(), &Shelf{Name: "shelves/1"})
+	if err != nil || res.GetBook() != nil {
+		t.Errorf("GetShelfBook of empty body = %v, %v", res, err)
+	}
+}
@@ -0,0 +1,287 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		policy   RetryPolicy
+		n        int
+		min, max time.Duration
+	}{
+		{RetryPolicy{}, 1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{RetryPolicy{}, 2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{RetryPolicy{}, 3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{RetryPolicy{}, 20, 5 * time.Second, 10 * time.Second},
+		{RetryPolicy{InitialBackoff: time.Second, Multiplier: 3}, 3, 4500 * time.Millisecond, 9 * time.Second},
+		{RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 2 * time.Second}, 5, time.Second, 2 * time.Second},
+		// a multiplier below 1 is the default 2
+		{RetryPolicy{InitialBackoff: time.Second, Multiplier: 0.5}, 2, time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := tt.policy.backoff(tt.n); d < tt.min || d > tt.max {
+				t.Errorf("%+v backoff(%d) = %v, want in [%v, %v]", tt.policy, tt.n, d, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	tests := []struct {
+		policy RetryPolicy
+		method string
+		status int
+		err    error
+		want   bool
+	}{
+		{RetryPolicy{}, "GET", 503, nil, true},
+		{RetryPolicy{}, "GET", 429, nil, true},
+		{RetryPolicy{}, "DELETE", 502, nil, true},
+		{RetryPolicy{}, "PUT", 504, nil, true},
+		{RetryPolicy{}, "GET", 500, nil, false},
+		{RetryPolicy{}, "GET", 200, nil, false},
+		// POST, PATCH and custom verbs are not idempotent
+		{RetryPolicy{}, "POST", 503, nil, false},
+		{RetryPolicy{}, "PATCH", 503, nil, false},
+		{RetryPolicy{}, "PURGE", 503, nil, false},
+		{RetryPolicy{RetryNonIdempotent: true}, "POST", 503, nil, true},
+		{RetryPolicy{RetryableCodes: []int{500}}, "GET", 500, nil, true},
+		{RetryPolicy{RetryableCodes: []int{500}}, "GET", 503, nil, false},
+		// network errors are retried, errors of the context are not
+		{RetryPolicy{}, "GET", 0, &netError{}, true},
+		{RetryPolicy{}, "GET", 0, context.DeadlineExceeded, false},
+		{RetryPolicy{}, "GET", 0, context.Canceled, false},
+		{RetryPolicy{}, "POST", 0, &netError{}, false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "http://example.com", nil)
+		var resp *http.Response
+		if tt.status != 0 {
+			resp = &http.Response{StatusCode: tt.status}
+		}
+		if got := tt.policy.retryable(req, resp, tt.err); got != tt.want {
+			t.Errorf("%+v retryable(%s, %d, %v) = %v, want %v", tt.policy, tt.method, tt.status, tt.err, got, tt.want)
+		}
+	}
+}
+
+// netError is a network timeout.
+type netError struct{}
+
+func (*netError) Error() string   { return "i/o timeout" }
+func (*netError) Timeout() bool   { return true }
+func (*netError) Temporary() bool { return true }
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		v        string
+		min, max time.Duration
+		ok       bool
+	}{
+		{"", 0, 0, false},
+		{"0", 0, 0, true},
+		{"2", 2 * time.Second, 2 * time.Second, true},
+		{"-1", 0, 0, false},
+		{"soon", 0, 0, false},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour, true},
+		// a date in the past retries at once
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", tt.v)
+		d, ok := retryAfter(resp)
+		if ok != tt.ok || d < tt.min || d > tt.max {
+			t.Errorf("retryAfter(%q) = %v, %v, want in [%v, %v], %v", tt.v, d, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+	if _, ok := retryAfter(nil); ok {
+		t.Error("retryAfter(nil) ok")
+	}
+}
+
+// failingServer answers the first fails requests with status, and the others with an empty json object.
+func failingServer(t *testing.T, fails, status int, header http.Header) *testServer {
+	n := 0
+	return newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n++
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if n <= fails {
+			w.WriteHeader(status)
+		}
+		_, _ = w.Write([]byte("{}"))
+	})
+}
+
+// fastRetry is a retry policy with short delays.
+func fastRetry(p RetryPolicy) RetryPolicy {
+	p.InitialBackoff = time.Millisecond
+	return p
+}
+
+func TestRetryAttempts(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		fails  int
+		status int
+		// requests received
+		attempts int
+		// status of the error returned, 0 for success
+		errStatus int
+	}{
+		{"no policy", nil, 5, 503, 1, 503},
+		{"default attempts", []Option{WithRetry(fastRetry(RetryPolicy{}))}, 5, 503, 3, 503},
+		{"max attempts", []Option{WithRetry(fastRetry(RetryPolicy{MaxAttempts: 5}))}, 10, 503, 5, 503},
+		{"one attempt", []Option{WithRetry(fastRetry(RetryPolicy{MaxAttempts: 1}))}, 5, 503, 1, 503},
+		{"success", []Option{WithRetry(fastRetry(RetryPolicy{}))}, 2, 429, 3, 0},
+		{"not retryable", []Option{WithRetry(fastRetry(RetryPolicy{}))}, 5, 500, 1, 500},
+		{"retryable codes", []Option{WithRetry(fastRetry(RetryPolicy{RetryableCodes: []int{500}}))}, 1, 500, 2, 0},
+	}
+	for _, tt := range tests {
+		srv := failingServer(t, tt.fails, tt.status, nil)
+		svc := NewBindingService(append([]Option{WithAddr(srv.URL)}, tt.opts...)...)
+		_, err := svc.GetBook(context.Background(), &Book{Name: "books/1"})
+		if n := len(srv.requests()); n != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, n, tt.attempts)
+		}
+		var e *APIError
+		if tt.errStatus == 0 && err != nil || tt.errStatus != 0 && (!errors.As(err, &e) || e.StatusCode != tt.errStatus) {
+			t.Errorf("%s: err = %v, want status %d", tt.name, err, tt.errStatus)
+		}
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	tests := []struct {
+		policy   RetryPolicy
+		attempts int
+	}{
+		{fastRetry(RetryPolicy{}), 1},
+		{fastRetry(RetryPolicy{RetryNonIdempotent: true}), 3},
+	}
+	for _, tt := range tests {
+		srv := failingServer(t, 5, 503, nil)
+		// the second binding of GetBook is a POST with the message as the body
+		svc := NewBindingService(WithAddr(srv.URL), WithBinding(1), WithRetry(tt.policy))
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1", Title: "t"}); err == nil {
+			t.Errorf("RetryNonIdempotent %v: want the error of 503", tt.policy.RetryNonIdempotent)
+		}
+		reqs := srv.requests()
+		if len(reqs) != tt.attempts {
+			t.Errorf("RetryNonIdempotent %v: %d attempts, want %d", tt.policy.RetryNonIdempotent, len(reqs), tt.attempts)
+		}
+		// the body is rebuilt for every attempt
+		for i, r := range reqs {
+			if r.Method != "POST" || r.Body != reqs[0].Body || r.Body == "" {
+				t.Errorf("attempt %d: %s %q, want POST %q", i, r.Method, r.Body, reqs[0].Body)
+			}
+		}
+	}
+}
+
+func TestRetryBody(t *testing.T) {
+	// PUT is retried by default, the raw body of the HttpBody is sent again
+	srv := failingServer(t, 2, 502, nil)
+	svc := NewMediaService(WithAddr(srv.URL), WithRetry(fastRetry(RetryPolicy{})))
+	in := &UploadRequest{Name: "files/1", File: &httpbody.HttpBody{ContentType: "text/plain", Data: []byte("some data")}}
+	if _, err := svc.UploadFile(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	reqs := srv.requests()
+	if len(reqs) != 3 {
+		t.Fatalf("%d attempts, want 3", len(reqs))
+	}
+	for i, r := range reqs {
+		if r.Method != "PUT" || r.Body != "some data" || r.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("attempt %d: %s %q of %q", i, r.Method, r.Body, r.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	// Retry-After takes the place of the backoff
+	srv := failingServer(t, 1, 503, http.Header{"Retry-After": {"1"}})
+	svc := NewBindingService(WithAddr(srv.URL), WithRetry(fastRetry(RetryPolicy{})))
+	start := time.Now()
+	if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("retried after %v, want Retry-After of 1s", d)
+	}
+	if n := len(srv.requests()); n != 2 {
+		t.Errorf("%d attempts, want 2", n)
+	}
+
+	// the wait for the retry ends with the context
+	srv = failingServer(t, 1, 429, http.Header{"Retry-After": {strconv.Itoa(60)}})
+	svc = NewBindingService(WithAddr(srv.URL), WithRetry(fastRetry(RetryPolicy{})))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err := svc.GetBook(ctx, &Book{Name: "books/1"})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 10*time.Second {
+		t.Errorf("err = %v after %v, want context.DeadlineExceeded", err, time.Since(start))
+	}
+	if n := len(srv.requests()); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+}
+
+func TestMethodRetry(t *testing.T) {
+	srv := failingServer(t, 100, 503, nil)
+	opts := []Option{
+		WithAddr(srv.URL),
+		WithRetry(fastRetry(RetryPolicy{MaxAttempts: 2})),
+		WithMethodRetry("BindingService.GetBook", fastRetry(RetryPolicy{MaxAttempts: 4})),
+	}
+	tests := []struct {
+		name     string
+		call     func() error
+		attempts int
+	}{
+		{"method policy", func() error {
+			_, err := NewBindingService(opts...).GetBook(context.Background(), &Book{Name: "books/1"})
+			return err
+		}, 4},
+		{"other method", func() error {
+			_, err := NewShelfService(opts...).GetShelfBook(context.Background(), &Shelf{Name: "shelves/1"})
+			return err
+		}, 2},
+		// the method policy of the call overrides the one of the service
+		{"call option", func() error {
+			_, err := NewBindingService(opts...).GetBook(context.Background(), &Book{Name: "books/1"},
+				WithMethodRetry("BindingService.GetBook", RetryPolicy{MaxAttempts: 1}))
+			return err
+		}, 1},
+		// a method policy of another method does not apply
+		{"policy of another method", func() error {
+			_, err := NewBindingService(WithAddr(srv.URL), WithMethodRetry("ShelfService.GetShelfBook", fastRetry(RetryPolicy{}))).
+				GetBook(context.Background(), &Book{Name: "books/1"})
+			return err
+		}, 1},
+	}
+	for _, tt := range tests {
+		before := len(srv.requests())
+		if err := tt.call(); err == nil {
+			t.Errorf("%s: want the error of 503", tt.name)
+		}
+		if n := len(srv.requests()) - before; n != tt.attempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, n, tt.attempts)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gentest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// request is a request received by the test server.
+type request struct {
+	Method string
+	// escaped path
+	Path     string
+	Query    url.Values
+	RawQuery string
+	Header   http.Header
+	Body     string
+}
+
+// testServer records the requests it receives and answers them with the handler.
+type testServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	reqs []*request
+}
+
+// newTestServer starts a server answering with h, 200 and an empty json object when h is nil.
+func newTestServer(t *testing.T, h http.HandlerFunc) *testServer {
+	t.Helper()
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.reqs = append(s.reqs, &request{
+			Method:   r.Method,
+			Path:     r.URL.EscapedPath(),
+			Query:    r.URL.Query(),
+			RawQuery: r.URL.RawQuery,
+			Header:   r.Header,
+			Body:     string(bs),
+		})
+		s.mu.Unlock()
+		if h == nil {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+		h(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// requests returns the requests received so far.
+func (s *testServer) requests() []*request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*request(nil), s.reqs...)
+}
+
+// last returns the last request received.
+func (s *testServer) last(t *testing.T) *request {
+	t.Helper()
+	reqs := s.requests()
+	if len(reqs) == 0 {
+		t.Fatal("no request received")
+	}
+	return reqs[len(reqs)-1]
+}
@@ -0,0 +1,286 @@
+package gentest
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	hmacKey = []byte("secret key")
+	rsaKey  *rsa.PrivateKey
+)
+
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	if rsaKey == nil {
+		key, err := rsa.GenerateKey(crand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsaKey = key
+	}
+	return rsaKey
+}
+
+// signAlgorithm signs and checks messages as the server of the signed api does.
+type signAlgorithm struct {
+	name   string
+	signer func(t *testing.T, params map[string]string) Signer
+	sign   func(t *testing.T, msg string) []byte
+	verify func(t *testing.T, msg string, sig []byte) error
+}
+
+var signAlgorithms = []signAlgorithm{
+	{
+		name: "HMAC-SHA256",
+		signer: func(t *testing.T, params map[string]string) Signer {
+			return NewHMACSHA256Signer("HMAC-SHA256", hmacKey, params)
+		},
+		sign: func(t *testing.T, msg string) []byte {
+			mac := hmac.New(sha256.New, hmacKey)
+			mac.Write([]byte(msg))
+			return mac.Sum(nil)
+		},
+		verify: func(t *testing.T, msg string, sig []byte) error {
+			mac := hmac.New(sha256.New, hmacKey)
+			mac.Write([]byte(msg))
+			if !hmac.Equal(mac.Sum(nil), sig) {
+				return errors.New("signature mismatch")
+			}
+			return nil
+		},
+	},
+	{
+		name: "RSA-SHA256",
+		signer: func(t *testing.T, params map[string]string) Signer {
+			return NewRSASHA256Signer("WECHATPAY2-SHA256-RSA2048", testRSAKey(t), params)
+		},
+		sign: func(t *testing.T, msg string) []byte {
+			sum := sha256.Sum256([]byte(msg))
+			sig, err := rsa.SignPKCS1v15(crand.Reader, testRSAKey(t), crypto.SHA256, sum[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+		verify: func(t *testing.T, msg string, sig []byte) error {
+			sum := sha256.Sum256([]byte(msg))
+			return rsa.VerifyPKCS1v15(&testRSAKey(t).PublicKey, crypto.SHA256, sum[:], sig)
+		},
+	},
+}
+
+// authParams splits the Authorization header into its scheme and params.
+func authParams(t *testing.T, header string) (string, map[string]string) {
+	t.Helper()
+	i := strings.IndexByte(header, ' ')
+	if i < 0 {
+		t.Fatalf("Authorization %q has no scheme", header)
+	}
+	params := map[string]string{}
+	for _, pair := range strings.Split(header[i+1:], ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		v, err := strconv.Unquote(kv[len(kv)-1])
+		if len(kv) != 2 || err != nil {
+			t.Fatalf("Authorization %q has a bad param %q", header, pair)
+		}
+		params[kv[0]] = v
+	}
+	return header[:i], params
+}
+
+// checkSignature recomputes the canonical message of the received request and checks its signature,
+// it returns the params of the Authorization header.
+func checkSignature(t *testing.T, alg signAlgorithm, r *request) map[string]string {
+	t.Helper()
+	_, params := authParams(t, r.Header.Get("Authorization"))
+	uri := r.Path
+	if len(r.RawQuery) > 0 {
+		uri += "?" + r.RawQuery
+	}
+	msg := r.Method + "\n" + uri + "\n" + params["timestamp"] + "\n" + params["nonce_str"] + "\n" + r.Body + "\n"
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		t.Fatalf("%s: signature %q: %v", alg.name, params["signature"], err)
+	}
+	if err := alg.verify(t, msg, sig); err != nil {
+		t.Errorf("%s: signature of %q: %v", alg.name, msg, err)
+	}
+	secs, err := strconv.ParseInt(params["timestamp"], 10, 64)
+	if d := time.Since(time.Unix(secs, 0)); err != nil || d > time.Minute || d < -time.Minute {
+		t.Errorf("%s: timestamp %q is not now", alg.name, params["timestamp"])
+	}
+	return params
+}
+
+func TestSigner(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		in        *Book
+		method    string
+		uri       string
+		emptyBody bool
+	}{
+		{"get without body", nil, &Book{Name: "books/1"}, "GET", "/v1/books/1", true},
+		// the query is signed as it is sent
+		{"get with query", nil, &Book{Name: "books/1", Title: "a b&c/d"}, "GET", "/v1/books/1?title=a+b%26c%2Fd", true},
+		{"get with query options", []Option{WithQueryParam("lang", "zh")}, &Book{Name: "books/1", Title: "t"}, "GET", "/v1/books/1?lang=zh&title=t", true},
+		{"post with body", []Option{WithBinding(1)}, &Book{Name: "books/1", Title: "t"}, "POST", "/v1/books/1:get", false},
+	}
+	for _, alg := range signAlgorithms {
+		for _, tt := range tests {
+			srv := newTestServer(t, nil)
+			opts := append([]Option{WithAddr(srv.URL), WithSigner(alg.signer(t, map[string]string{"mchid": "m1"}))}, tt.opts...)
+			if _, err := NewBindingService(opts...).GetBook(context.Background(), tt.in); err != nil {
+				t.Fatalf("%s %s: %v", alg.name, tt.name, err)
+			}
+			r := srv.last(t)
+			uri := r.Path
+			if len(r.RawQuery) > 0 {
+				uri += "?" + r.RawQuery
+			}
+			if r.Method != tt.method || uri != tt.uri || (r.Body == "") != tt.emptyBody {
+				t.Errorf("%s %s: request %s %s %q", alg.name, tt.name, r.Method, uri, r.Body)
+			}
+			params := checkSignature(t, alg, r)
+			if params["mchid"] != "m1" || len(params["nonce_str"]) != 32 || len(params) != 4 {
+				t.Errorf("%s %s: Authorization params %v", alg.name, tt.name, params)
+			}
+		}
+	}
+}
+
+func TestSignerHeader(t *testing.T) {
+	srv := newTestServer(t, nil)
+	signer := NewHMACSHA256Signer("HMAC-SHA256", hmacKey, map[string]string{"key_id": "k1", "alg": "hs256"})
+	if _, err := NewBindingService(WithAddr(srv.URL), WithSigner(signer)).GetBook(context.Background(), &Book{Name: "books/1"}); err != nil {
+		t.Fatal(err)
+	}
+	header := srv.last(t).Header.Get("Authorization")
+	scheme, params := authParams(t, header)
+	// the params are sorted by name
+	want := fmt.Sprintf(`HMAC-SHA256 alg="hs256",key_id="k1",nonce_str=%q,signature=%q,timestamp=%q`,
+		params["nonce_str"], params["signature"], params["timestamp"])
+	if scheme != "HMAC-SHA256" || header != want {
+		t.Errorf("Authorization = %s, want %s", header, want)
+	}
+}
+
+func TestSignerRetry(t *testing.T) {
+	// every attempt is signed again with a new nonce and the body sent again
+	for _, alg := range signAlgorithms {
+		srv := failingServer(t, 2, 503, nil)
+		svc := NewBindingService(WithAddr(srv.URL), WithBinding(1), WithSigner(alg.signer(t, nil)),
+			WithRetry(fastRetry(RetryPolicy{RetryNonIdempotent: true})))
+		if _, err := svc.GetBook(context.Background(), &Book{Name: "books/1", Title: "t"}); err != nil {
+			t.Fatalf("%s: %v", alg.name, err)
+		}
+		reqs := srv.requests()
+		if len(reqs) != 3 {
+			t.Fatalf("%s: %d attempts, want 3", alg.name, len(reqs))
+		}
+		nonces := map[string]bool{}
+		for _, r := range reqs {
+			if r.Body != reqs[0].Body || r.Body == "" {
+				t.Errorf("%s: attempt body %q, want %q", alg.name, r.Body, reqs[0].Body)
+			}
+			nonces[checkSignature(t, alg, r)["nonce_str"]] = true
+		}
+		if len(nonces) != 3 {
+			t.Errorf("%s: %d nonces for 3 attempts", alg.name, len(nonces))
+		}
+	}
+}
+
+// signedServer answers with body signed in the headers of the Wechatpay- prefix at the timestamp,
+// change alters the headers after signing.
+func signedServer(t *testing.T, alg signAlgorithm, timestamp time.Time, body string, change func(http.Header)) *testServer {
+	return newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		ts, nonce := strconv.FormatInt(timestamp.Unix(), 10), "N1"
+		h := w.Header()
+		h.Set("Content-Type", "application/json")
+		h.Set("Wechatpay-Timestamp", ts)
+		h.Set("Wechatpay-Nonce", nonce)
+		h.Set("Wechatpay-Signature", base64.StdEncoding.EncodeToString(alg.sign(t, ts+"\n"+nonce+"\n"+body+"\n")))
+		if change != nil {
+			change(h)
+		}
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+func TestVerifier(t *testing.T) {
+	body := `{"name":"books/1","title":"t"}`
+	verifiers := map[string]func(window time.Duration) Verifier{
+		"HMAC-SHA256": func(window time.Duration) Verifier { return NewHMACSHA256Verifier(hmacKey, "Wechatpay-", window) },
+		"RSA-SHA256": func(window time.Duration) Verifier {
+			return NewRSASHA256Verifier(&testRSAKey(t).PublicKey, "Wechatpay-", window)
+		},
+	}
+	tests := []struct {
+		name      string
+		timestamp time.Duration
+		window    time.Duration
+		change    func(http.Header)
+		// part of the error, empty for success
+		err string
+	}{
+		{"valid", 0, 0, nil, ""},
+		{"within the default window", -4 * time.Minute, 0, nil, ""},
+		{"stale", -6 * time.Minute, 0, nil, "is not within 5m0s of now"},
+		{"future", 6 * time.Minute, 0, nil, "is not within 5m0s of now"},
+		{"within a custom window", -time.Hour + time.Minute, time.Hour, nil, ""},
+		{"out of a custom window", -2 * time.Minute, time.Minute, nil, "is not within 1m0s of now"},
+		{"missing timestamp", 0, 0, func(h http.Header) { h.Del("Wechatpay-Timestamp") }, "missing response timestamp"},
+		{"bad timestamp", 0, 0, func(h http.Header) { h.Set("Wechatpay-Timestamp", "now") }, `invalid response timestamp "now"`},
+		// the timestamp is signed
+		{"changed timestamp", 0, 0, func(h http.Header) {
+			ts, _ := strconv.ParseInt(h.Get("Wechatpay-Timestamp"), 10, 64)
+			h.Set("Wechatpay-Timestamp", strconv.FormatInt(ts+1, 10))
+		}, "verify response"},
+		{"changed nonce", 0, 0, func(h http.Header) { h.Set("Wechatpay-Nonce", "N2") }, "verify response"},
+		{"missing signature", 0, 0, func(h http.Header) { h.Del("Wechatpay-Signature") }, "invalid response signature"},
+		{"bad signature", 0, 0, func(h http.Header) { h.Set("Wechatpay-Signature", "AAAA") }, "verify response"},
+	}
+	for _, alg := range signAlgorithms {
+		for _, tt := range tests {
+			srv := signedServer(t, alg, time.Now().Add(tt.timestamp), body, tt.change)
+			svc := NewBindingService(WithAddr(srv.URL), WithVerifier(verifiers[alg.name](tt.window)))
+			res, err := svc.GetBook(context.Background(), &Book{Name: "books/1"})
+			if tt.err == "" && (err != nil || res.GetTitle() != "t") {
+				t.Errorf("%s %s: GetBook = %v, %v", alg.name, tt.name, res, err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), "verify response")) {
+				t.Errorf("%s %s: err = %v, want %q", alg.name, tt.name, err, tt.err)
+			}
+		}
+	}
+
+	// a body other than the signed one is rejected
+	alg := signAlgorithms[0]
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Wechatpay-Timestamp", ts)
+		w.Header().Set("Wechatpay-Nonce", "N1")
+		w.Header().Set("Wechatpay-Signature", base64.StdEncoding.EncodeToString(alg.sign(t, ts+"\nN1\n"+body+"\n")))
+		_, _ = w.Write([]byte(`{"name":"books/1","title":"changed"}`))
+	})
+	_, err := NewBindingService(WithAddr(srv.URL), WithVerifier(verifiers[alg.name](0))).GetBook(context.Background(), &Book{Name: "books/1"})
+	if err == nil || !strings.Contains(err.Error(), "response signature mismatch") {
+		t.Errorf("err = %v, want signature mismatch of the changed body", err)
+	}
+}
@@ -0,0 +1,191 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// streamServer writes the frames of the stream in the content type, flushing each one.
+// When wait is set it blocks after the frames until the client goes away, and closes closed then.
+func streamServer(t *testing.T, contentType string, frames []string, wait bool, closed chan struct{}) *testServer {
+	return newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		for _, f := range frames {
+			_, _ = w.Write([]byte(f))
+			w.(http.Flusher).Flush()
+		}
+		if wait {
+			<-r.Context().Done()
+			close(closed)
+		}
+	})
+}
+
+// recvAll receives the names of the books until an error.
+func recvAll(stream StreamService_WatchClient) ([]string, error) {
+	var names []string
+	for {
+		b, err := stream.Recv()
+		if err != nil {
+			return names, err
+		}
+		names = append(names, b.GetName())
+	}
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestServerStreamNDJSON(t *testing.T) {
+	srv := streamServer(t, "application/x-ndjson", []string{
+		`{"name":"b1"}` + "\n",
+		"\n",
+		`{"result":{"name":"b2"}}` + "\r\n",
+		`{"result":{"name":"b3"},"error":null}` + "\n",
+		// the last line needs no newline
+		`{"name":"b4"}`,
+	}, false, nil)
+	stream, err := NewStreamService(WithAddr(srv.URL)).Watch(context.Background(), &Book{Name: "books/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := recvAll(stream)
+	if err != io.EOF || !equalNames(names, []string{"b1", "b2", "b3", "b4"}) {
+		t.Errorf("Recv = %v, %v", names, err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Recv after the end = %v, want io.EOF", err)
+	}
+	if r := srv.last(t); r.Method != "GET" || r.Path != "/v1/books/1:watch" {
+		t.Errorf("request %s %s", r.Method, r.Path)
+	}
+}
+
+func TestServerStreamErrorFrame(t *testing.T) {
+	closed := make(chan struct{})
+	srv := streamServer(t, "application/json", []string{
+		`{"result":{"name":"b1"}}` + "\n",
+		`{"error":{"code":13,"message":"boom","details":[]}}` + "\n",
+		`{"result":{"name":"b2"}}` + "\n",
+	}, true, closed)
+	stream, err := NewStreamService(WithAddr(srv.URL)).Watch(context.Background(), &Book{Name: "books/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := recvAll(stream)
+	var e *APIError
+	if !errors.As(err, &e) || !equalNames(names, []string{"b1"}) {
+		t.Fatalf("Recv = %v, %v, want *APIError after b1", names, err)
+	}
+	if e.Method != "StreamService.Watch" || e.Code != 13 || e.Message != "boom" || e.StatusCode != http.StatusOK {
+		t.Errorf("APIError = %+v", e)
+	}
+	// the error frame ends the stream without reading further
+	if _, err2 := stream.Recv(); err2 != err {
+		t.Errorf("Recv after the error = %v, want %v", err2, err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("the body is not closed after the error frame")
+	}
+}
+
+func TestServerStreamSSE(t *testing.T) {
+	srv := streamServer(t, "text/event-stream; charset=utf-8", []string{
+		": comment\n",
+		"retry: 1000\n",
+		"id: 1\nevent: message\ndata: {\"name\":\ndata:  \"b1\"}\n\n",
+		"data:{\"name\":\"b2\"}\r\n\r\n",
+		// frames without data are skipped
+		"event: ping\n\n",
+		"data: {\"result\":{\"name\":\"b3\"}}\n\n",
+		"event: error\ndata: {\"code\":3,\n",
+		"data: \"message\":\"bad\"}\n\n",
+		"data: {\"name\":\"b4\"}\n\n",
+	}, false, nil)
+	stream, err := NewStreamService(WithAddr(srv.URL)).Watch(context.Background(), &Book{Name: "books/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := recvAll(stream)
+	var e *APIError
+	if !errors.As(err, &e) || e.Code != 3 || e.Message != "bad" || !equalNames(names, []string{"b1", "b2", "b3"}) {
+		t.Fatalf("Recv = %v, %v, want b1 b2 b3 and the error event", names, err)
+	}
+	if _, err2 := stream.Recv(); err2 != err {
+		t.Errorf("Recv after the error = %v, want %v", err2, err)
+	}
+
+	// an incomplete frame at the end is discarded
+	srv = streamServer(t, "text/event-stream", []string{"data: {\"name\":\"b1\"}\n\n", "data: {\"name\":\"b2\"}\n"}, false, nil)
+	stream, err = NewStreamService(WithAddr(srv.URL)).Watch(context.Background(), &Book{Name: "books/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names, err = recvAll(stream); err != io.EOF || !equalNames(names, []string{"b1"}) {
+		t.Errorf("Recv = %v, %v", names, err)
+	}
+}
+
+func TestServerStreamCancel(t *testing.T) {
+	closed := make(chan struct{})
+	srv := streamServer(t, "application/x-ndjson", []string{`{"name":"b1"}` + "\n"}, true, closed)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := NewStreamService(WithAddr(srv.URL)).Watch(ctx, &Book{Name: "books/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := stream.Recv(); err != nil || b.GetName() != "b1" {
+		t.Fatalf("Recv = %v, %v", b, err)
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.Recv()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Recv after cancel = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Recv is not unblocked by the cancellation of ctx")
+	}
+	if _, err := stream.Recv(); err != context.Canceled {
+		t.Errorf("Recv after cancel = %v, want context.Canceled", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("the request is not closed after cancel")
+	}
+}
+
+func TestServerStreamOpenError(t *testing.T) {
+	srv := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code":5,"message":"no book"}`))
+	})
+	_, err := NewStreamService(WithAddr(srv.URL)).Watch(context.Background(), &Book{Name: "books/1"})
+	var e *APIError
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound || e.Message != "no book" || e.Method != "StreamService.Watch" {
+		t.Errorf("Watch = %v, want APIError of 404", err)
+	}
+}
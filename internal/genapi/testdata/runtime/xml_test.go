@@ -0,0 +1,253 @@
+package gentest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const xmlProto = `
+name: "xml.proto"
+package: "gentest"
+dependency: "google/protobuf/timestamp.proto"
+syntax: "proto3"
+message_type {
+  name: "Order"
+  field { name: "out_trade_no" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "outTradeNo" }
+  field { name: "total_fee" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 json_name: "totalFee" }
+  field { name: "paid" number: 3 label: LABEL_OPTIONAL type: TYPE_BOOL json_name: "paid" }
+  field { name: "rate" number: 4 label: LABEL_OPTIONAL type: TYPE_DOUBLE json_name: "rate" }
+  field { name: "state" number: 5 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".gentest.State" json_name: "state" }
+  field { name: "sign" number: 6 label: LABEL_OPTIONAL type: TYPE_BYTES json_name: "sign" }
+  field { name: "tags" number: 7 label: LABEL_REPEATED type: TYPE_STRING json_name: "tags" }
+  field { name: "item" number: 8 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".gentest.Item" json_name: "item" }
+  field { name: "items" number: 9 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".gentest.Item" json_name: "items" }
+  field { name: "attrs" number: 10 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".gentest.Order.AttrsEntry" json_name: "attrs" }
+  field { name: "stocks" number: 11 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".gentest.Order.StocksEntry" json_name: "stocks" }
+  field { name: "create_time" number: 12 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" json_name: "createTime" }
+  field { name: "counts" number: 13 label: LABEL_REPEATED type: TYPE_UINT32 json_name: "counts" }
+  nested_type {
+    name: "AttrsEntry"
+    field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "key" }
+    field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "value" }
+    options { map_entry: true }
+  }
+  nested_type {
+    name: "StocksEntry"
+    field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "key" }
+    field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".gentest.Item" json_name: "value" }
+    options { map_entry: true }
+  }
+}
+message_type {
+  name: "Item"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+  field { name: "count" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "count" }
+}
+enum_type { name: "State" value { name: "STATE_UNSPECIFIED" number: 0 } value { name: "PAID" number: 1 } }
+`
+
+// xmlOrder returns the descriptor of gentest.Order.
+func xmlOrder(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	fdp := &descriptorpb.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(xmlProto), fdp); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().ByName("Order")
+}
+
+// newOrder parses a text format gentest.Order.
+func newOrder(t *testing.T, md protoreflect.MessageDescriptor, text string) proto.Message {
+	t.Helper()
+	m := dynamicpb.NewMessage(md)
+	if err := prototext.Unmarshal([]byte(text), m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+const orderText = `
+out_trade_no: "a<b & \"c\""
+total_fee: -100
+paid: true
+rate: 0.5
+state: PAID
+sign: "\x00\xff"
+tags: "x" tags: "" tags: "z"
+item { name: "i1" count: 1 }
+items { name: "i2" } items { count: 3 }
+attrs { key: "b" value: "2" } attrs { key: "a" value: "1" }
+stocks { key: 2 value { name: "s2" } } stocks { key: 10 value { name: "s10" } }
+create_time { seconds: 1577934245 }
+counts: 1 counts: 4294967295
+`
+
+func TestXMLRoundTrip(t *testing.T) {
+	md := xmlOrder(t)
+	in := newOrder(t, md, orderText)
+	bs, err := marshalXML("xml", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := dynamicpb.NewMessage(md)
+	if err := unmarshalXML(bs, out); err != nil {
+		t.Fatalf("unmarshalXML(%s): %v", bs, err)
+	}
+	if !proto.Equal(in, out) {
+		t.Errorf("round trip of %s\ngot  %v\nwant %v", bs, out, in)
+	}
+}
+
+func TestMarshalXML(t *testing.T) {
+	md := xmlOrder(t)
+	bs, err := marshalXML("xml", newOrder(t, md, orderText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(bs)
+	for _, want := range []string{
+		`<xml><out_trade_no>a&lt;b &amp; &#34;c&#34;</out_trade_no><total_fee>-100</total_fee>`,
+		`<paid>true</paid><rate>0.5</rate><state>PAID</state><sign>AP8=</sign>`,
+		// repeated fields repeat the element, empty strings included
+		`<tags>x</tags><tags></tags><tags>z</tags>`,
+		`<item><name>i1</name><count>1</count></item><items><name>i2</name></items><items><count>3</count></items>`,
+		// map entries are sorted by key
+		`<attrs><key>a</key><value>1</value></attrs><attrs><key>b</key><value>2</value></attrs>`,
+		`<stocks><key>10</key><value><name>s10</name></value></stocks><stocks><key>2</key><value><name>s2</name></value></stocks>`,
+		`<create_time>2020-01-02T03:04:05Z</create_time><counts>1</counts><counts>4294967295</counts></xml>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("marshalXML = %s\nwant %s", got, want)
+		}
+	}
+
+	// unset fields are omitted
+	bs, err = marshalXML("Order", dynamicpb.NewMessage(md))
+	if err != nil || string(bs) != `<Order></Order>` {
+		t.Errorf("marshalXML(empty) = %s, %v", bs, err)
+	}
+}
+
+func TestUnmarshalXML(t *testing.T) {
+	md := xmlOrder(t)
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- comment -->
+<xml>
+  <out_trade_no><![CDATA[a<b & "c"]]></out_trade_no>
+  <totalFee> -100 </totalFee>
+  <paid>true</paid>
+  <state>1</state>
+  <tags><![CDATA[x]]></tags>
+  <unknown><nested>1</nested></unknown>
+  <tags>z</tags>
+  <item><name>i1</name><extra/><count>1</count></item>
+  <items><name>i2</name></items>
+  <items><count>3</count></items>
+  <attrs><key>a</key><value>1</value></attrs>
+  <attrs><value>empty key</value></attrs>
+  <stocks><key>2</key></stocks>
+  <create_time>2020-01-02T03:04:05Z</create_time>
+</xml>`
+	got := dynamicpb.NewMessage(md)
+	if err := unmarshalXML([]byte(body), got); err != nil {
+		t.Fatal(err)
+	}
+	want := newOrder(t, md, `
+out_trade_no: "a<b & \"c\"" total_fee: -100 paid: true state: PAID tags: "x" tags: "z"
+item { name: "i1" count: 1 } items { name: "i2" } items { count: 3 }
+attrs { key: "a" value: "1" } attrs { key: "" value: "empty key" } stocks { key: 2 value {} }
+create_time { seconds: 1577934245 }`)
+	if !proto.Equal(got, want) {
+		t.Errorf("unmarshalXML\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestUnmarshalXMLError(t *testing.T) {
+	md := xmlOrder(t)
+	for _, body := range []string{
+		`<xml><total_fee>abc</total_fee></xml>`,
+		`<xml><paid>yes</paid></xml>`,
+		`<xml><state>REFUNDED</state></xml>`,
+		`<xml><sign>!!</sign></xml>`,
+		`<xml><item><count>1</count></xml>`,
+		`<xml><create_time>yesterday</create_time></xml>`,
+	} {
+		if err := unmarshalXML([]byte(body), dynamicpb.NewMessage(md)); err == nil {
+			t.Errorf("unmarshalXML(%s) want error", body)
+		}
+	}
+	// empty bodies are ignored
+	if err := unmarshalXML([]byte("  \n"), dynamicpb.NewMessage(md)); err != nil {
+		t.Errorf("unmarshalXML(empty) = %v", err)
+	}
+}
+
+func TestXMLResponse(t *testing.T) {
+	md := xmlOrder(t)
+	tests := []struct {
+		contentType, body string
+		v                 func(m proto.Message) interface{}
+		want              string
+	}{
+		{"text/xml; charset=utf-8", `<xml><out_trade_no>o1</out_trade_no></xml>`,
+			func(m proto.Message) interface{} { return m }, `out_trade_no: "o1"`},
+		{"application/xml", `<xml><out_trade_no>o2</out_trade_no></xml>`,
+			func(m proto.Message) interface{} { return m }, `out_trade_no: "o2"`},
+		{"application/atom+xml", `<feed><out_trade_no>o3</out_trade_no></feed>`,
+			func(m proto.Message) interface{} { return m }, `out_trade_no: "o3"`},
+		// with response_body the root element is the value of the field
+		{"text/xml", `<item><name>i1</name></item>`,
+			func(m proto.Message) interface{} { return &ResponseBody{Field: "item", Message: m} }, `item { name: "i1" }`},
+		{"text/xml", `<tags>x</tags>`,
+			func(m proto.Message) interface{} { return &ResponseBody{Field: "tags", Message: m} }, `tags: "x"`},
+		// json is decoded as before
+		{"application/json", `{"outTradeNo":"o4"}`,
+			func(m proto.Message) interface{} { return m }, `out_trade_no: "o4"`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Type", tt.contentType)
+		_, _ = w.WriteString(tt.body)
+		got := dynamicpb.NewMessage(md)
+		if err := buildOptions(newOptions()).DoResponse(context.Background(), w.Result(), tt.v(got)); err != nil {
+			t.Errorf("%s %s: %v", tt.contentType, tt.body, err)
+			continue
+		}
+		if want := newOrder(t, md, tt.want); !proto.Equal(got, want) {
+			t.Errorf("%s %s: got %v, want %v", tt.contentType, tt.body, got, want)
+		}
+	}
+}
+
+func TestIsXML(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"application/xml":          true,
+		"text/xml; charset=utf-8":  true,
+		"Application/XML":          true,
+		"application/soap+xml":     true,
+		"application/json":         false,
+		"text/plain":               false,
+		"":                         false,
+		"application/xml-dtd":      false,
+		"application/vnd.api+json": false,
+	} {
+		if got := isXML(ct); got != want {
+			t.Errorf("isXML(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
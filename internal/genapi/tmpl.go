@@ -21,6 +21,11 @@ import (
 	strings "strings"
 	url "net/url"
 	multipart "mime/multipart"
+	time "time"
+	proto "google.golang.org/protobuf/proto"
+{{- range .Imports }}
+	{{ .Name }} "{{ .Path }}"
+{{- end }}
 )
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = context.Background
@@ -32,6 +37,8 @@ var _ = strings.Compare
 var _ = fmt.Errorf
 var _ = url.Parse
 var _ = multipart.ErrMessageTooLarge
+var _ = time.Second
+var _ = proto.Clone
 
 {{ range .Services }}
 // Client API for {{ .ServName }} service
@@ -39,7 +46,23 @@ var _ = multipart.ErrMessageTooLarge
 type {{ .ServName }}Service interface {
 {{- range .Methods }}
 	// {{ .MethName }} {{ .Comment }}
+	{{- if .ServerStream }}
+	{{ .MethName }}(ctx context.Context, in *{{ .ReqTyp }}, opts ...Option) ({{ .ServName }}Service_{{ .MethName }}Client, error)
+	{{- else if .ClientStream }}
+	{{ .MethName }}(ctx context.Context, opts ...Option) ({{ .ServName }}Service_{{ .MethName }}Client, error)
+	{{- else }}
 	{{ .MethName }}(ctx context.Context, in *{{ .ReqTyp }}, opts ...Option) (*{{ .ResTyp }}, error)
+	{{- end }}
+	{{- if .LRO }}
+	// {{ .MethName }}Operation wraps the operation returned by {{ .MethName }}, which can be
+	// resumed with the operation name only.
+	{{ .MethName }}Operation(op *{{ .ResTyp }}, opts ...Option) *{{ .ServName }}{{ .MethName }}Operation
+	{{- end }}
+	{{- if .Page }}
+	// {{ .MethName }}Iter iterates over {{ .Page.ItemsField }} of all the pages of {{ .MethName }},
+	// starting from the page_token of in.
+	{{ .MethName }}Iter(ctx context.Context, in *{{ .ReqTyp }}, opts ...Option) *{{ .ServName }}{{ .MethName }}Iterator
+	{{- end }}
 {{- end }}
 }
 
@@ -53,52 +76,295 @@ func New{{ .ServName }}Service(opts ...Option) {{ .ServName }}Service {
 	if len(opt.addr) <= 0 {
 		opt.addr = "https://{{ .PkgName }}"
 	}
+	{{- with .Envelope }}
+	opt.envelope = &envelope{
+		codeField:    {{ quote .CodeField }},
+		messageField: {{ quote .MessageField }},
+		successValue: {{ quote .SuccessValue }},
+		dataField:    {{ quote .DataField }},
+	}
+	{{- end }}
 	return &{{ unexport .ServName }}Service {
 		opts: opt,
 	}
 }
 
 {{ range .Methods }}
+{{- if .ServerStream }}
+func (c *{{ unexport .ServName }}Service) {{ .MethName }}(ctx context.Context, in *{{ .ReqTyp }}, opts ...Option) ({{ .ServName }}Service_{{ .MethName }}Client, error) {
+	{{ .ReqCode | html }}
+}
+
+type {{ .ServName }}Service_{{ .MethName }}Client interface {
+	// Recv returns the next message of the stream, io.EOF when the stream ends.
+	// After an error frame or the end of the stream, Recv keeps returning the same error.
+	Recv() (*{{ .ResTyp }}, error)
+	// Close closes the stream.
+	Close() error
+}
+
+type {{ unexport .ServName }}Service{{ .MethName }}Client struct {
+	*serverStream
+}
+
+func (x *{{ unexport .ServName }}Service{{ .MethName }}Client) Recv() (*{{ .ResTyp }}, error) {
+	m := new({{ .ResTyp }})
+	if err := x.serverStream.recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+{{ else if .ClientStream }}
+func (c *{{ unexport .ServName }}Service) {{ .MethName }}(ctx context.Context, opts ...Option) ({{ .ServName }}Service_{{ .MethName }}Client, error) {
+	{{ .ReqCode | html }}
+}
+
+type {{ .ServName }}Service_{{ .MethName }}Client interface {
+	// Send writes a message to the request body, io.EOF means the request has finished
+	// and the error is returned by CloseAndRecv.
+	Send(*{{ .ReqTyp }}) error
+	// CloseAndRecv closes the request body and returns the response.
+	CloseAndRecv() (*{{ .ResTyp }}, error)
+}
+
+type {{ unexport .ServName }}Service{{ .MethName }}Client struct {
+	*clientStream
+}
+
+func (x *{{ unexport .ServName }}Service{{ .MethName }}Client) Send(m *{{ .ReqTyp }}) error {
+	return x.clientStream.send(m)
+}
+
+func (x *{{ unexport .ServName }}Service{{ .MethName }}Client) CloseAndRecv() (*{{ .ResTyp }}, error) {
+	m := new({{ .ResTyp }})
+	if err := x.clientStream.closeAndRecv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+{{ else }}
 func (c *{{ unexport .ServName }}Service) {{ .MethName }}(ctx context.Context, in *{{ .ReqTyp }}, opts ...Option) (*{{ .ResTyp }}, error) {
-	var res {{ .ResTyp }}
 	{{ .ReqCode | html }}
 }
-{{ end -}}
+{{ end }}
+{{- if .LRO }}
+func (c *{{ unexport .ServName }}Service) {{ .MethName }}Operation(op *{{ .ResTyp }}, opts ...Option) *{{ .ServName }}{{ .MethName }}Operation {
+	return &{{ .ServName }}{{ .MethName }}Operation{
+		lro: newOperation(buildOptions(c.opts, opts...), "{{ .LRO.Prefix }}", op),
+	}
+}
+
+// {{ .ServName }}{{ .MethName }}Operation manages a long-running operation from {{ .MethName }}.
+type {{ .ServName }}{{ .MethName }}Operation struct {
+	lro *operation
+}
+
+// Name returns the name of the operation.
+func (op *{{ .ServName }}{{ .MethName }}Operation) Name() string {
+	return op.lro.name()
+}
+
+// Done reports whether the operation has completed.
+func (op *{{ .ServName }}{{ .MethName }}Operation) Done() bool {
+	return op.lro.done()
+}
+
+// Proto returns the latest state of the raw operation.
+func (op *{{ .ServName }}{{ .MethName }}Operation) Proto() *{{ .ResTyp }} {
+	return op.lro.op.(*{{ .ResTyp }})
+}
+
+// Poll fetches the latest state of the operation once,
+// the response is nil until the operation has completed.
+func (op *{{ .ServName }}{{ .MethName }}Operation) Poll(ctx context.Context, opts ...Option) (*{{ .LRO.ResTyp }}, error) {
+	if err := op.lro.poll(ctx, opts...); err != nil {
+		return nil, err
+	}
+	return op.Response()
+}
+
+// Wait polls the operation until it has completed and returns the response.
+func (op *{{ .ServName }}{{ .MethName }}Operation) Wait(ctx context.Context, opts ...Option) (*{{ .LRO.ResTyp }}, error) {
+	if err := op.lro.wait(ctx, opts...); err != nil {
+		return nil, err
+	}
+	return op.Response()
+}
+
+// Response returns the response of the completed operation, nil if it has not completed,
+// or the OperationError if it failed.
+func (op *{{ .ServName }}{{ .MethName }}Operation) Response() (*{{ .LRO.ResTyp }}, error) {
+	res := new({{ .LRO.ResTyp }})
+	if ok, err := op.lro.result(res); !ok {
+		return nil, err
+	}
+	return res, nil
+}
+{{- if .LRO.MetaTyp }}
+
+// Metadata returns the metadata of the operation, nil if there is none.
+func (op *{{ .ServName }}{{ .MethName }}Operation) Metadata() (*{{ .LRO.MetaTyp }}, error) {
+	meta := new({{ .LRO.MetaTyp }})
+	if ok, err := op.lro.metadata(meta); !ok {
+		return nil, err
+	}
+	return meta, nil
+}
+{{- end }}
+{{ end }}
+{{- if .Page }}
+func (c *{{ unexport .ServName }}Service) {{ .MethName }}Iter(ctx context.Context, in *{{ .ReqTyp }}, opts ...Option) *{{ .ServName }}{{ .MethName }}Iterator {
+	req := proto.Clone(in).(*{{ .ReqTyp }})
+	it := &{{ .ServName }}{{ .MethName }}Iterator{
+		pager: newPager(buildOptions(c.opts, opts...), in.GetPageToken()),
+	}
+	it.fetch = func(token string) (*{{ .ResTyp }}, error) {
+		req.PageToken = token
+		return c.{{ .MethName }}(ctx, req, opts...)
+	}
+	return it
+}
+
+// {{ .ServName }}{{ .MethName }}Iterator iterates over the pages of {{ .MethName }}.
+type {{ .ServName }}{{ .MethName }}Iterator struct {
+	*pager
+	fetch func(token string) (*{{ .ResTyp }}, error)
+	res   *{{ .ResTyp }}
+	items []{{ .Page.ItemTyp }}
+}
+
+// Next returns the next item, ErrIteratorDone when there are no more items.
+func (it *{{ .ServName }}{{ .MethName }}Iterator) Next() ({{ .Page.ItemTyp }}, error) {
+	for len(it.items) == 0 {
+		if _, err := it.NextPage(); err != nil {
+			var zero {{ .Page.ItemTyp }}
+			return zero, err
+		}
+	}
+	item := it.items[0]
+	it.items = it.items[1:]
+	return item, nil
+}
+
+// NextPage fetches the next page and returns its items, ErrIteratorDone when there are no more pages.
+// The items of the current page not yet returned by Next are dropped.
+func (it *{{ .ServName }}{{ .MethName }}Iterator) NextPage() ([]{{ .Page.ItemTyp }}, error) {
+	it.items = nil
+	if err := it.pager.check(); err != nil {
+		return nil, err
+	}
+	res, err := it.fetch(it.pager.token)
+	n := it.pager.update(res.GetNextPageToken(), len(res.Get{{ .Page.ItemsField }}()), err)
+	if err != nil {
+		return nil, err
+	}
+	it.res = res
+	it.items = res.Get{{ .Page.ItemsField }}()[:n]
+	return it.items, nil
+}
+
+// Response returns the raw response of the current page, nil before the first page.
+func (it *{{ .ServName }}{{ .MethName }}Iterator) Response() *{{ .ResTyp }} {
+	return it.res
+}
+{{ end }}
+{{- end }}
 
 {{ end -}}
 `
 
-var requestCode = `// options
+var requestCode = `
+	{{- if not (or .ServerStream .ClientStream) -}}
+	var res {{ .ResTyp }}
+	{{ end -}}
+	// options
 	opt := buildOptions(c.opts, opts...)
+	{{- if not (or .ServerStream .ClientStream) }}
+	ctx, cancel := opt.withTimeout(ctx, {{ with .Timeout }}{{ . }}{{ else }}0{{ end }})
+	defer cancel()
+	{{- end }}
 	headers := make(map[string]string)
-	// route
+	{{- if .ClientStream }}
+	body, bodyWriter := io.Pipe()
+	{{- end }}
+	var req *http.Request
+	var err error
+	call := &CallInfo{Service: "{{ .ServName }}", Method: "{{ .MethName }}"}
+	{{- if .HasResponseBody }}
+	var out interface{} = &res
+	{{- end }}
+	{{- if eq (len .Bindings) 1 }}
+	{{ template "binding" index .Bindings 0 }}
+	{{- else }}
+	switch opt.binding {
+	{{- range $i, $b := .Bindings }}
+	case {{ $i }}: // {{ $b.Verb }} {{ $b.Route }}
+		{{ template "binding" $b }}
+	{{- end }}
+	default:
+		return nil, fmt.Errorf("{{ .MethName }} has no http binding %d", opt.binding)
+	}
+	{{- end }}
+	// header
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	opt.setRequest(req)
+	{{- if not .Unauthenticated }}
+	if err := opt.authorize(req); err != nil {
+		return nil, err
+	}
+	{{- end }}
+	{{- if .ServerStream }}
+	stream, err := newServerStream(ctx, opt, req, call)
+	if err != nil {
+		return nil, err
+	}
+	return &{{ unexport (replace .ServName "Service" "") }}Service{{ .MethName }}Client{stream}, nil
+	{{- else if .ClientStream }}
+	stream := newClientStream(ctx, opt, req, body, bodyWriter, call)
+	return &{{ unexport (replace .ServName "Service" "") }}Service{{ .MethName }}Client{stream}, nil
+	{{- else }}
+	resp, err := opt.do(ctx, req, call)
+	if err != nil {
+		return nil, err
+	}
+	{{- if .HasResponseBody }}
+	err = opt.DoResponse(ctx, resp, out)
+	{{- else }}
+	err = opt.DoResponse(ctx, resp, &res)
+	{{- end }}
+	return &res, setErrorMethod(err, "{{ .ServName }}.{{ .MethName }}")
+	{{- end }}
+{{ define "binding" }}// route
+	call.Route, call.Verb = {{ quote .Route }}, "{{ .Verb }}"
 	{{ .RouteCode }}
 	// body
 	{{ .BodyCode }}
 	{{- if eq .BodyCode "" -}}
-	req, err := http.NewRequest("{{ .Verb }}", rawURL, nil)
+	req, err = http.NewRequestWithContext(ctx, "{{ .Verb }}", rawURL, nil)
 	{{- else }}
-	req, err := http.NewRequest("{{ .Verb }}", rawURL, body)
+	req, err = http.NewRequestWithContext(ctx, "{{ .Verb }}", rawURL, body)
 	{{- end }}
 	if err != nil {
 		return nil, err
 	}
-	{{ if ne .QueryCode "" }}
+	{{ if or (ne .QueryCode "") (not .Unauthenticated) }}
 	params := req.URL.Query()
-	{{ .QueryCode | html }}	
-	req.URL.RawQuery = params.Encode()
-	{{ end }}
-	// header
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-	resp, err := opt.DoRequest(ctx, opt.client, req)
-	if err != nil {
+	{{- with .QueryCode }}
+	{{ . | html }}
+	{{- end }}
+	{{- if not .Unauthenticated }}
+	if err := opt.addQueryToken(ctx, params); err != nil {
 		return nil, err
 	}
-	err = opt.DoResponse(ctx, resp, &res)
-	return &res, err 
-`
+	{{- end }}
+	req.URL.RawQuery = params.Encode()
+	{{ end }}
+	{{- if .ResponseBody }}
+	out = &ResponseBody{Field: {{ quote .ResponseBody }}, Message: &res}
+	{{- end }}
+{{- end }}`
 
 var bodyFormCode = `bodyForms := url.Values{} 
 	{{ .Body }}
@@ -107,13 +373,16 @@ var bodyFormCode = `bodyForms := url.Values{}
 `
 
 var bodyMultiCode = `body := new(bytes.Buffer)
-	bodyForms := multipart.NewWriter(body) 
+	bodyForms := multipart.NewWriter(body)
 	{{ .Body }}
-	defer func() { _ =  bodyForms.Close() } ()
-	headers["Content-Type"] = "multipart/form-data"
+	// Close writes the closing boundary, the body must be complete before the request is sent.
+	if err := bodyForms.Close(); err != nil {
+		return nil, err
+	}
+	headers["Content-Type"] = bodyForms.FormDataContentType()
 `
 
-var bodyJsonCode = `bs, err := json.Marshal({{ .Body | html }})
+var bodyJsonCode = `bs, err := opt.marshalJSON({{ .Body | html }})
 	if err != nil {
 		return nil, err
 	}
@@ -121,10 +390,27 @@ var bodyJsonCode = `bs, err := json.Marshal({{ .Body | html }})
 	headers["Content-Type"] = "application/json"
 `
 
+var bodyXmlCode = `bs, err := marshalXML({{ quote .Root }}, {{ .Body }})
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.NewReader(bs)
+	headers["Content-Type"] = "application/xml"
+`
+
 var bodyByteCode = `body := bytes.NewReader({{ .Body }})
 	headers["Content-Type"] = "application/json"
 `
 
+var bodyStreamCode = `headers["Content-Type"] = "application/json"
+`
+
+var bodyHttpCode = `body := bytes.NewReader({{ .Body }}.GetData())
+	if ct := {{ .Body }}.GetContentType(); ct != "" {
+		headers["Content-Type"] = ct
+	}
+`
+
 func buildFrame(data *FileData) (string, error) {
 	frm, err := template.New("frame_tmpl").Funcs(fn).Parse(frame)
 	if err != nil {
@@ -140,7 +426,7 @@ func buildFrame(data *FileData) (string, error) {
 	return bs.String(), nil
 }
 
-func buildRequestCode(data *CodeData) (string, error) {
+func buildRequestCode(data *RequestData) (string, error) {
 	rct, err := template.New("request_code_tmpl").Funcs(fn).Parse(requestCode)
 	if err != nil {
 		log.Println("parse request code template err:", err)
@@ -207,6 +493,24 @@ func buildBodyJsonCode(body string) (string, error) {
 
 }
 
+func buildBodyXmlCode(body, root string) (string, error) {
+	bxt, err := template.New("body_xml_tmpl").Funcs(fn).Parse(bodyXmlCode)
+	if err != nil {
+		log.Println("parse xml code template err: ", err)
+		return "", err
+	}
+	bs := new(bytes.Buffer)
+	err = bxt.Execute(bs, map[string]string{
+		"Body": body,
+		"Root": root,
+	})
+	if err != nil {
+		log.Println("execute xml code template err: ", err)
+		return "", err
+	}
+	return bs.String(), nil
+}
+
 func buildBodyByteCode(body string) (string, error) {
 	bbt, err := template.New("body_byte_tmpl").Funcs(fn).Parse(bodyByteCode)
 	if err != nil {
@@ -223,3 +527,35 @@ func buildBodyByteCode(body string) (string, error) {
 	}
 	return bs.String(), nil
 }
+
+func buildBodyHttpCode(body string) (string, error) {
+	bht, err := template.New("body_http_tmpl").Funcs(fn).Parse(bodyHttpCode)
+	if err != nil {
+		log.Println("parse http body code template err: ", err)
+		return "", err
+	}
+	bs := new(bytes.Buffer)
+	err = bht.Execute(bs, map[string]string{
+		"Body": body,
+	})
+	if err != nil {
+		log.Println("execute http body code template err: ", err)
+		return "", err
+	}
+	return bs.String(), nil
+}
+
+func buildBodyStreamCode() (string, error) {
+	bst, err := template.New("body_stream_tmpl").Funcs(fn).Parse(bodyStreamCode)
+	if err != nil {
+		log.Println("parse stream body code template err: ", err)
+		return "", err
+	}
+	bs := new(bytes.Buffer)
+	err = bst.Execute(bs, nil)
+	if err != nil {
+		log.Println("execute stream body code template err: ", err)
+		return "", err
+	}
+	return bs.String(), nil
+}
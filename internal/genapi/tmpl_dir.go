@@ -0,0 +1,59 @@
+package genapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// tmplExt template_dir 里模板文件的后缀
+const tmplExt = ".tmpl"
+
+// builtinTemplates 可以通过 template_dir 覆盖的内置模板，文件名为 <name>.tmpl
+var builtinTemplates = map[string]*string{
+	"frame":       &frame,
+	"request":     &requestCode,
+	"body_form":   &bodyFormCode,
+	"body_multi":  &bodyMultiCode,
+	"body_json":   &bodyJsonCode,
+	"body_byte":   &bodyByteCode,
+	"body_http":   &bodyHttpCode,
+	"body_xml":    &bodyXmlCode,
+	"body_stream": &bodyStreamCode,
+	"option":      &optsCode,
+}
+
+// loadTemplates overrides the builtin templates with the <name>.tmpl files in dir.
+func loadTemplates(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read template_dir: %v", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), tmplExt) {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), tmplExt)
+		tmpl, ok := builtinTemplates[name]
+		if !ok {
+			return fmt.Errorf("unknown template %s in template_dir, must be one of %s", f.Name(), strings.Join(templateNames(), ", "))
+		}
+		bs, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return fmt.Errorf("read template %s: %v", f.Name(), err)
+		}
+		*tmpl = string(bs)
+	}
+	return nil
+}
+
+func templateNames() []string {
+	names := make([]string, 0, len(builtinTemplates))
+	for name := range builtinTemplates {
+		names = append(names, name+tmplExt)
+	}
+	sort.Strings(names)
+	return names
+}
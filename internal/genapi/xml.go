@@ -0,0 +1,43 @@
+package genapi
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// xmlNameRe 可用作根元素名的xml名字，不支持命名空间前缀
+var xmlNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// checkXMLBody checks the xml body of the rest rule is a singular message and the root element name is valid.
+func checkXMLBody(meth *descriptor.MethodDescriptorProto, rest *restInfo) error {
+	if rest.body != "*" {
+		f := lookupField(meth.GetInputType(), rest.body)
+		if f == nil {
+			return fmt.Errorf("%s: body %q is not a field of %s", meth.GetName(), rest.body, meth.GetInputType())
+		}
+		if f.GetType() != fieldTypeMessage || f.GetLabel() == fieldLabelRepeated {
+			return fmt.Errorf("%s: xml body %q must be a singular message field", meth.GetName(), rest.body)
+		}
+	}
+	if len(rest.xmlRoot) > 0 && !xmlNameRe.MatchString(rest.xmlRoot) {
+		return fmt.Errorf("%s: invalid xml root element name %q", meth.GetName(), rest.xmlRoot)
+	}
+	return nil
+}
+
+// xmlRoot returns the root element name of the xml body, defaults to the name of the body message.
+func xmlRoot(meth *descriptor.MethodDescriptorProto, rest *restInfo) string {
+	if len(rest.xmlRoot) > 0 {
+		return rest.xmlRoot
+	}
+	typ := meth.GetInputType()
+	if rest.body != "*" {
+		typ = lookupField(meth.GetInputType(), rest.body).GetTypeName()
+	}
+	if msg, ok := descInfo.Type[typ].(*descriptor.DescriptorProto); ok {
+		return msg.GetName()
+	}
+	return "xml"
+}
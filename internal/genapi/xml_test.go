@@ -0,0 +1,80 @@
+package genapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+const xmlProto = `
+name: "pay.proto"
+package: "pay.v1"
+dependency: "google/api/annotations.proto"
+message_type {
+  name: "Order"
+  field { name: "out_trade_no" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "outTradeNo" }
+}
+message_type {
+  name: "CreateOrderRequest"
+  field { name: "order" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".pay.v1.Order" json_name: "order" }
+  field { name: "orders" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".pay.v1.Order" json_name: "orders" }
+  field { name: "mch_id" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "mchId" }
+}
+service {
+  name: "PayService"
+  method {
+    name: "Unified" input_type: ".pay.v1.CreateOrderRequest" output_type: ".pay.v1.Order"
+    options { [google.api.http] { post: "/pay/unified" body: "*,xml" } }
+  }
+  method {
+    name: "Refund" input_type: ".pay.v1.CreateOrderRequest" output_type: ".pay.v1.Order"
+    options { [google.api.http] { post: "/pay/refund" body: "*,xml,xml" } }
+  }
+  method {
+    name: "Close" input_type: ".pay.v1.CreateOrderRequest" output_type: ".pay.v1.Order"
+    options { [google.api.http] { post: "/pay/close/{mch_id}" body: "order,xml" } }
+  }
+}
+options { go_package: "example.com/pay;pay" }
+syntax: "proto3"
+`
+
+func TestGenXMLBody(t *testing.T) {
+	code := genFiles(t, "", xmlProto)["example.com/pay/pay.api.go"]
+	for _, want := range []string{
+		// the root element defaults to the name of the body message
+		`bs, err := marshalXML("CreateOrderRequest", in)`,
+		`bs, err := marshalXML("xml", in)`,
+		`bs, err := marshalXML("Order", in.GetOrder())`,
+		`headers["Content-Type"] = "application/xml"`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %s:\n%s", want, code)
+		}
+	}
+}
+
+func TestGenXMLBodyError(t *testing.T) {
+	tests := []struct {
+		body, err string
+	}{
+		{`body: "orders,xml"`, `xml body "orders" must be a singular message field`},
+		{`body: "mch_id,xml"`, `xml body "mch_id" must be a singular message field`},
+		{`body: "*,xml,soap:Envelope"`, `invalid xml root element name "soap:Envelope"`},
+		{`body: "*,xml,1xml"`, `invalid xml root element name "1xml"`},
+	}
+	for _, tt := range tests {
+		fd := &descriptor.FileDescriptorProto{}
+		if err := prototext.Unmarshal([]byte(strings.Replace(xmlProto, `body: "*,xml"`, tt.body, 1)), fd); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Gen(&plugin.CodeGeneratorRequest{ProtoFile: []*descriptor.FileDescriptorProto{fd}, FileToGenerate: []string{fd.GetName()}, Parameter: proto.String("")})
+		if err == nil || !strings.Contains(err.Error(), "Unified: "+tt.err) {
+			t.Errorf("%s: err = %v", tt.body, err)
+		}
+	}
+}
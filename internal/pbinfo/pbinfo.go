@@ -175,18 +175,20 @@ func (in *Info) NameSpec(e ProtoType) (string, ImportSpec, error) {
 		return name, ImportSpec{Path: pkg[:p], Name: appendpb(pkg[p+1:])}, nil
 	}
 
+	// The version elements are only skipped for the name, the import path is kept whole.
+	path, elem := pkg, pkg
 	for {
-		p := strings.LastIndexByte(pkg, '/')
+		p := strings.LastIndexByte(elem, '/')
 		if p < 0 {
-			return name, ImportSpec{Path: pkg, Name: appendpb(pkg)}, nil
+			return name, ImportSpec{Path: path, Name: appendpb(elem)}, nil
 		}
-		elem := pkg[p+1:]
-		if len(elem) >= 2 && elem[0] == 'v' && elem[1] >= '0' && elem[1] <= '9' {
+		last := elem[p+1:]
+		if len(last) >= 2 && last[0] == 'v' && last[1] >= '0' && last[1] <= '9' {
 			// It's a version number; skip so we get a more meaningful name
-			pkg = pkg[:p]
+			elem = elem[:p]
 			continue
 		}
-		return name, ImportSpec{Path: pkg, Name: appendpb(elem)}, nil
+		return name, ImportSpec{Path: path, Name: appendpb(last)}, nil
 	}
 }
 
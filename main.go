@@ -24,7 +24,7 @@ func main() {
 
 	genResp, err := genapi.Gen(&genReq)
 	if err != nil {
-		genResp.Error = proto.String(err.Error())
+		genResp = &plugin.CodeGeneratorResponse{Error: proto.String(err.Error())}
 	}
 
 	genResp.SupportedFeatures = proto.Uint64(uint64(plugin.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL))